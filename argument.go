@@ -0,0 +1,130 @@
+package readline
+
+import (
+	"strconv"
+)
+
+// the numeric argument stops growing at it like GNU readline
+const argumentMax = 1000000
+
+// the commands which are repeated by the numeric argument, mapped to the
+// ones in the opposite direction for a negative argument
+var argumentCommands = map[rune]rune{
+	CharDelete:    CharBackspace,
+	CharBackspace: CharDelete,
+	CharCtrlH:     CharDelete,
+	CharForward:   CharBackward,
+	CharBackward:  CharForward,
+	MetaForward:   MetaBackward,
+	MetaBackward:  MetaForward,
+	MetaDelete:    MetaBackspace,
+	MetaBackspace: MetaDelete,
+	CharCtrlW:     MetaDelete,
+	CharNext:      CharPrev,
+	CharPrev:      CharNext,
+	CharTranspose: CharTranspose,
+	CharCtrlY:     CharCtrlY,
+
+	MetaTranspose:  MetaTranspose,
+	MetaUpcase:     MetaUpcase,
+	MetaDowncase:   MetaDowncase,
+	MetaCapitalize: MetaCapitalize,
+}
+
+// the commands which run once whatever the numeric argument is, but in the
+// opposite direction for a negative argument
+var argumentDirections = map[rune]rune{
+	CharKill:  CharCtrlU,
+	CharCtrlU: CharKill,
+}
+
+func isMetaDigit(r rune) bool {
+	return r <= MetaDigit0 && r >= MetaDigit9
+}
+
+// IsArgumentKey reports whether r starts a numeric argument, which is
+// Meta-digit, Meta-- or Config.UniversalArgument.
+func (o *Operation) IsArgumentKey(r rune) bool {
+	if isMetaDigit(r) || r == MetaMinus {
+		return true
+	}
+	u := o.GetConfig().UniversalArgument
+	return u != 0 && r == u
+}
+
+// ReadArgument reads the numeric argument started by r and returns the
+// command after it with the times to run it, "(arg: n) " is shown before
+// the prompt meanwhile. The command runs in the opposite direction if n
+// is negative.
+func (o *Operation) ReadArgument(r rune) (rune, int) {
+	universal := o.GetConfig().UniversalArgument
+	arg, neg := 1, false
+	// digits are typed, or they are ended by another universal-argument
+	hasDigit, digitEnded, isUniversal := false, false, false
+
+	prefix := o.buf.PromptPrefix()
+	defer o.buf.SetPromptPrefix(prefix, true)
+	for {
+		digit := -1
+		if isMetaDigit(r) {
+			digit = int(MetaDigit0 - r)
+		} else if r >= '0' && r <= '9' && !digitEnded {
+			digit = int(r - '0')
+		}
+
+		switch {
+		case digit >= 0:
+			if !hasDigit {
+				arg, hasDigit = 0, true
+			}
+			if arg*10+digit <= argumentMax {
+				arg = arg*10 + digit
+			}
+		case !hasDigit && (r == MetaMinus || r == '-' && isUniversal):
+			arg, neg = 1, true
+		case universal != 0 && r == universal:
+			if hasDigit {
+				digitEnded = true
+			} else if arg*4 <= argumentMax {
+				arg *= 4
+			}
+			isUniversal = true
+		default:
+			if r == CharDelete {
+				// the terminal stops reading after Ctrl-D until it's handled
+				o.t.KickRead()
+			}
+			return argumentCommand(r, arg, neg)
+		}
+
+		n := arg
+		if neg {
+			n = -n
+		}
+		o.buf.SetPromptPrefix("(arg: "+strconv.Itoa(n)+") ", true)
+		for process := false; !process; {
+			if r = o.t.ReadRune(); r == 0 {
+				return 0, 1
+			}
+			r, process = o.filterInputRune(r)
+		}
+	}
+}
+
+// argumentCommand returns the command to run by the argument and the times
+// to run it
+func argumentCommand(r rune, n int, neg bool) (rune, int) {
+	if reverse, ok := argumentCommands[r]; ok {
+		if neg {
+			r = reverse
+		}
+		return r, n
+	}
+	if IsPrintable(r) {
+		return r, n
+	}
+	if reverse, ok := argumentDirections[r]; ok && neg {
+		r = reverse
+	}
+	return r, 1
+}
@@ -0,0 +1,64 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/test"
+)
+
+func TestArgument(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Keys string
+		Line string
+	}{
+		{"\0334x", "xxxx"},
+		{"\0331" + "2-", "------------"},
+		{"abcdef\033[D\033[D\0333\x04", "abcd"},
+		{"abcdef\0333\x02\0332\x04", "abcf"},
+		{"abcdef\033-\0332\x04", "abcd"},
+		{"one two three\033-\033d", "one two "},
+		{"ab\0333\x04", "ab"},
+		{"\x15x", "xxxx"},
+		{"\x15\x15x", strings.Repeat("x", 16)},
+		{"\x15" + "3x", "xxx"},
+		{"\x15" + "3\x15" + "2", "222"},
+		{"\x15-a", "a"},
+		{"abcdef\033[D\033[D\0333\x0b", "abcd"},
+		{"abcdef\033[D\033[D\033-\x0b", "ef"},
+		{"x ab\x17\0333\x19", "x ababab"},
+	}
+	for i, r := range ret {
+		line, err := readTestLine(&Config{UniversalArgument: CharCtrlU}, r.Keys+"\r")
+		test.Nil(err)
+		test.Equal(line, r.Line, fmt.Errorf("%v", i))
+	}
+}
+
+func TestArgumentHooks(t *testing.T) {
+	defer test.New(t)
+
+	// the hooks see the key once whatever the times it runs
+	filtered, changed := 0, 0
+	line, err := readTestLine(&Config{
+		FuncFilterInputRune: func(r rune) (rune, bool) {
+			if r == 'x' {
+				filtered++
+			}
+			return r, true
+		},
+		Listener: FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+			if key == 'x' {
+				changed++
+			}
+			return nil, 0, false
+		}),
+	}, "\0334x\r")
+	test.Nil(err)
+	test.Equal(line, "xxxx")
+	test.Equal(filtered, 1)
+	test.Equal(changed, 1)
+}
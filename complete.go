@@ -3,8 +3,9 @@ package readline
 import (
 	"bufio"
 	"bytes"
-	"fmt"
 	"io"
+	"strings"
+	"unicode"
 )
 
 type AutoCompleter interface {
@@ -18,6 +19,26 @@ type AutoCompleter interface {
 	Do(line []rune, pos int) (newLine [][]rune, length int)
 }
 
+// CandidateDescriber can be implemented by an AutoCompleter to show
+// a description beside each candidate in complete mode, the whole
+// description of the selected candidate is previewed under them.
+type CandidateDescriber interface {
+	// candidate is the whole word, including the part already typed
+	Describe(candidate string) string
+}
+
+// the styles of showing the candidates, see Config.CompleteStyle
+const (
+	// list the candidates in a grid, double Tab to select one
+	CompleteStyleGrid = iota
+	// replace the word by the candidates in place on each Tab, like the
+	// menu-complete of GNU readline
+	CompleteStyleMenu
+)
+
+// the max lines of the description shown under the candidates in select mode
+const completePreviewMaxLines = 10
+
 type TabCompleter struct{}
 
 func (t *TabCompleter) Do([]rune, int) ([][]rune, int) {
@@ -36,6 +57,15 @@ type opCompleter struct {
 	candidateOff    int
 	candidateChoise int
 	candidateColNum int
+
+	// the length of typed word which is replaced by the candidate
+	candidateReplace int
+	// the positions of the matched runes in the candidates
+	candidateMatch [][]int
+
+	inMenuMode    bool
+	menuSource    []rune
+	menuSourceIdx int
 }
 
 func newOpCompleter(w io.Writer, op *Operation, width int) *opCompleter {
@@ -48,7 +78,7 @@ func newOpCompleter(w io.Writer, op *Operation, width int) *opCompleter {
 
 func (o *opCompleter) doSelect() {
 	if len(o.candidate) == 1 {
-		o.op.buf.WriteRunes(o.candidate[0])
+		o.writeCandidate(o.candidate[0])
 		o.ExitCompleteMode(false)
 		return
 	}
@@ -84,7 +114,7 @@ func (o *opCompleter) OnComplete() bool {
 
 	o.ExitCompleteSelectMode()
 	o.candidateSource = rs
-	newLines, offset := o.op.cfg.AutoComplete.Do(rs, buf.idx)
+	newLines, offset := o.doComplete(rs, buf.idx)
 	if len(newLines) == 0 {
 		o.ExitCompleteMode(false)
 		return true
@@ -93,10 +123,19 @@ func (o *opCompleter) OnComplete() bool {
 	// only Aggregate candidates in non-complete mode
 	if !o.IsInCompleteMode() {
 		if len(newLines) == 1 {
-			buf.WriteRunes(newLines[0])
+			o.writeCandidate(newLines[0])
 			o.ExitCompleteMode(false)
 			return true
 		}
+		if o.op.cfg.CompleteStyle == CompleteStyleMenu {
+			o.EnterCompleteMenuMode(newLines)
+			return true
+		}
+		if o.candidateReplace > 0 {
+			// the candidates don't share the typed word as prefix
+			o.EnterCompleteMode(offset, newLines)
+			return true
+		}
 
 		same, size := runes.Aggregate(newLines)
 		if size > 0 {
@@ -110,6 +149,49 @@ func (o *opCompleter) OnComplete() bool {
 	return true
 }
 
+// doComplete calls the AutoCompleter for candidates. In the substring and
+// fuzzy match mode, the typed word is removed from the line so that the
+// AutoCompleter returns all the candidates, which are filtered and ranked
+// by the typed word then.
+func (o *opCompleter) doComplete(rs []rune, pos int) ([][]rune, int) {
+	o.candidateReplace = 0
+	o.candidateMatch = nil
+
+	mode := o.op.cfg.CompleteMatch
+	if mode != CompleteMatchSubstring && mode != CompleteMatchFuzzy {
+		return o.op.cfg.AutoComplete.Do(rs, pos)
+	}
+
+	start := pos
+	for start > 0 && !unicode.IsSpace(rs[start-1]) {
+		start--
+	}
+	if start == pos {
+		return o.op.cfg.AutoComplete.Do(rs, pos)
+	}
+	line := append(runes.Copy(rs[:start]), rs[pos:]...)
+	cands, offset := o.op.cfg.AutoComplete.Do(line, start)
+	if offset != 0 {
+		// the AutoCompleter doesn't agree with the word, fallback to prefix
+		return o.op.cfg.AutoComplete.Do(rs, pos)
+	}
+
+	newLines, matched := matchCandidates(mode, rs[start:pos], cands)
+	o.candidateReplace = pos - start
+	o.candidateMatch = matched
+	return newLines, 0
+}
+
+// writeCandidate writes the candidate into the buffer, the typed word is
+// replaced by the candidate in the substring and fuzzy match mode.
+func (o *opCompleter) writeCandidate(c []rune) {
+	buf := o.op.buf
+	pos := buf.Pos()
+	if !buf.replace(buf.Runes(), pos-o.candidateReplace, pos, c) {
+		o.op.t.Bell()
+	}
+}
+
 func (o *opCompleter) IsInCompleteSelectMode() bool {
 	return o.inSelectMode
 }
@@ -123,7 +205,7 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 	switch r {
 	case CharEnter, CharCtrlJ:
 		next = false
-		o.op.buf.WriteRunes(o.op.candidate[o.op.candidateChoise])
+		o.writeCandidate(o.op.candidate[o.op.candidateChoise])
 		o.ExitCompleteMode(false)
 	case CharLineStart:
 		num := o.candidateChoise % o.candidateColNum
@@ -139,6 +221,8 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 		next = false
 	case CharTab, CharForward:
 		o.doSelect()
+	case MetaShiftTab:
+		o.nextCandidate(-1)
 	case CharBell, CharInterrupt:
 		o.ExitCompleteMode(true)
 		next = false
@@ -173,6 +257,49 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 	return false
 }
 
+func (o *opCompleter) IsInCompleteMenuMode() bool {
+	return o.inMenuMode
+}
+
+// HandleCompleteMenu cycles the candidates by Tab and Shift-Tab, Ctrl-G
+// restores the original word. Other keys accept the current candidate
+// and return false so that the key can be processed as usual.
+func (o *opCompleter) HandleCompleteMenu(r rune) bool {
+	switch r {
+	case CharTab:
+		o.nextCandidate(1)
+		o.menuApply()
+	case MetaShiftTab:
+		o.nextCandidate(-1)
+		o.menuApply()
+	case CharBell:
+		o.op.buf.SetWithIdx(o.menuSourceIdx, o.menuSource)
+		o.ExitCompleteMode(true)
+	default:
+		o.ExitCompleteMode(false)
+		return false
+	}
+	return true
+}
+
+func (o *opCompleter) EnterCompleteMenuMode(candidate [][]rune) {
+	o.inMenuMode = true
+	o.candidate = candidate
+	o.candidateChoise = 0
+	o.menuSource = o.op.buf.Runes()
+	o.menuSourceIdx = o.op.buf.Pos()
+	o.menuApply()
+}
+
+// replace the word of menuSource with the chosen candidate
+func (o *opCompleter) menuApply() {
+	c := o.candidate[o.candidateChoise]
+	start := o.menuSourceIdx - o.candidateReplace
+	if !o.op.buf.replace(o.menuSource, start, o.menuSourceIdx, c) {
+		o.op.t.Bell()
+	}
+}
+
 func (o *opCompleter) getMatrixSize() int {
 	line := len(o.candidate) / o.candidateColNum
 	if len(o.candidate)%o.candidateColNum != 0 {
@@ -189,7 +316,6 @@ func (o *opCompleter) CompleteRefresh() {
 	if !o.inCompleteMode {
 		return
 	}
-	lineCnt := o.op.buf.CursorLineCount()
 	colWidth := 0
 	for _, c := range o.candidate {
 		w := runes.WidthAll(c)
@@ -203,42 +329,144 @@ func (o *opCompleter) CompleteRefresh() {
 	// -1 to avoid reach the end of line
 	width := o.width - 1
 	colNum := width / colWidth
-	if colNum != 0 {
+	descs := o.describeCandidates(same)
+	if descs != nil {
+		// one candidate per line, followed by its description
+		colNum = 1
+	} else if colNum != 0 {
 		colWidth += (width - (colWidth * colNum)) / colNum
 	}
 
 	o.candidateColNum = colNum
-	buf := bufio.NewWriter(o.w)
-	buf.Write(bytes.Repeat([]byte("\n"), lineCnt))
+	out := bytes.NewBuffer(nil)
+	buf := bufio.NewWriter(out)
 
 	colIdx := 0
-	lines := 1
-	buf.WriteString("\033[J")
 	for idx, c := range o.candidate {
 		inSelect := idx == o.candidateChoise && o.IsInCompleteSelectMode()
 		if inSelect {
 			buf.WriteString("\033[30;47m")
 		}
 		buf.WriteString(string(same))
-		buf.WriteString(string(c))
+		o.writeMatched(buf, idx)
 		buf.Write(bytes.Repeat([]byte(" "), colWidth-runes.WidthAll(c)-runes.WidthAll(same)))
 
 		if inSelect {
 			buf.WriteString("\033[0m")
 		}
+		if descs != nil {
+			buf.WriteString(descriptionCell(descs[idx], width-colWidth))
+		}
 
 		colIdx++
 		if colIdx == colNum {
 			buf.WriteString("\n")
-			lines++
 			colIdx = 0
 		}
 	}
 
-	// move back
-	fmt.Fprintf(buf, "\033[%dA\r", lineCnt-1+lines)
-	fmt.Fprintf(buf, "\033[%dC", o.op.buf.idx+o.op.buf.PromptLen())
+	if preview := o.previewLines(same, width); len(preview) > 0 {
+		if colIdx != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\033[2m" + strings.Repeat("─", width) + "\033[0m")
+		for _, line := range preview {
+			buf.WriteString("\n")
+			buf.WriteString(line)
+		}
+	}
 	buf.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	o.op.buf.SetBelow(lines, true)
+}
+
+// write the candidate with the matched runes underlined
+func (o *opCompleter) writeMatched(buf *bufio.Writer, idx int) {
+	c := o.candidate[idx]
+	if idx >= len(o.candidateMatch) || len(o.candidateMatch[idx]) == 0 {
+		buf.WriteString(string(c))
+		return
+	}
+	matched := o.candidateMatch[idx]
+	for i, r := range c {
+		if len(matched) > 0 && matched[0] == i {
+			buf.WriteString("\033[4m")
+			buf.WriteRune(r)
+			buf.WriteString("\033[24m")
+			matched = matched[1:]
+			continue
+		}
+		buf.WriteRune(r)
+	}
+}
+
+// describe the candidates if the AutoCompleter supports it,
+// return nil if none of them has description.
+func (o *opCompleter) describeCandidates(same []rune) []string {
+	describer, ok := o.op.cfg.AutoComplete.(CandidateDescriber)
+	if !ok {
+		return nil
+	}
+	found := false
+	descs := make([]string, len(o.candidate))
+	for idx, c := range o.candidate {
+		word := strings.TrimSpace(string(same) + string(c))
+		descs[idx] = describer.Describe(word)
+		if descs[idx] != "" {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return descs
+}
+
+// previewLines returns the whole description of the selected candidate,
+// which is shown under the candidates and wrapped by the width.
+func (o *opCompleter) previewLines(same []rune, width int) []string {
+	if !o.IsInCompleteSelectMode() || o.candidateChoise < 0 || o.candidateChoise >= len(o.candidate) {
+		return nil
+	}
+	describer, ok := o.op.cfg.AutoComplete.(CandidateDescriber)
+	if !ok || width <= 0 {
+		return nil
+	}
+	word := strings.TrimSpace(string(same) + string(o.candidate[o.candidateChoise]))
+	desc := strings.TrimRight(describer.Describe(word), "\n")
+	if desc == "" {
+		return nil
+	}
+	desc = strings.Replace(desc, "\t", strings.Repeat(" ", TabWidth), -1)
+
+	var lines []string
+	for _, line := range strings.Split(desc, "\n") {
+		sp := SplitByLine(0, width, []rune(line))
+		if len(sp) > 1 && sp[len(sp)-1] == "" {
+			sp = sp[:len(sp)-1]
+		}
+		lines = append(lines, sp...)
+	}
+	if len(lines) > completePreviewMaxLines {
+		lines = lines[:completePreviewMaxLines]
+	}
+	return lines
+}
+
+// only the first line of description is shown, truncated to fit the width
+func descriptionCell(desc string, width int) string {
+	if idx := strings.IndexRune(desc, '\n'); idx >= 0 {
+		desc = desc[:idx]
+	}
+	if desc == "" || width <= 2 {
+		return ""
+	}
+	rs := []rune(desc)
+	for runes.WidthAll(rs) > width-2 {
+		rs = rs[:len(rs)-1]
+	}
+	return "  \033[2m" + string(rs) + "\033[0m"
 }
 
 func (o *opCompleter) aggCandidate(candidate [][]rune) int {
@@ -277,9 +505,14 @@ func (o *opCompleter) ExitCompleteSelectMode() {
 	o.candidateChoise = -1
 	o.candidateOff = -1
 	o.candidateSource = nil
+	o.candidateReplace = 0
+	o.candidateMatch = nil
 }
 
 func (o *opCompleter) ExitCompleteMode(revent bool) {
+	o.op.buf.SetBelow(nil, false)
 	o.inCompleteMode = false
+	o.inMenuMode = false
+	o.menuSource = nil
 	o.ExitCompleteSelectMode()
 }
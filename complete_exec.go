@@ -0,0 +1,161 @@
+package readline
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const execCompleterCacheSize = 64
+
+var errExecCompleterTimeout = errors.New("completer timed out")
+
+// ExecCompleter is an AutoCompleter which asks a external program for the
+// candidates, the program speaks the protocol of bash's `complete -C`:
+//
+// It is called as `program <command> <word> <previous word>` with
+// COMP_LINE, COMP_POINT, COMP_WORDS and COMP_CWORD in the environment,
+// and prints one candidate per line to stdout.
+type ExecCompleter struct {
+	Path string
+	// Args are placed before the arguments of the protocol
+	Args []string
+	// kill the program and its children if it doesn't finish in time, 1s by
+	// default
+	Timeout time.Duration
+	// the extra environment variables in the form of `key=value`
+	Env []string
+
+	m     sync.Mutex
+	cache map[string][]string
+}
+
+func NewExecCompleter(path string, args ...string) *ExecCompleter {
+	return &ExecCompleter{
+		Path: path,
+		Args: args,
+	}
+}
+
+func (e *ExecCompleter) Do(line []rune, pos int) (newLine [][]rune, offset int) {
+	words, cword := splitCompWords(line[:pos])
+	current := words[cword]
+
+	cands, ok := e.fromCache(line[:pos])
+	if !ok {
+		var err error
+		cands, err = e.run(line, pos, words, cword)
+		if err != nil {
+			return nil, 0
+		}
+		e.toCache(line[:pos], cands)
+	}
+
+	for _, cand := range cands {
+		if !strings.HasPrefix(cand, current) {
+			continue
+		}
+		newLine = append(newLine, []rune(cand[len(current):]+" "))
+	}
+	return newLine, len([]rune(current))
+}
+
+// ClearCache drops the results of the previous calls, it should be
+// called if the candidates are going to change.
+func (e *ExecCompleter) ClearCache() {
+	e.m.Lock()
+	e.cache = nil
+	e.m.Unlock()
+}
+
+func (e *ExecCompleter) fromCache(prefix []rune) ([]string, bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	cands, ok := e.cache[string(prefix)]
+	return cands, ok
+}
+
+func (e *ExecCompleter) toCache(prefix []rune, cands []string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.cache == nil || len(e.cache) >= execCompleterCacheSize {
+		e.cache = make(map[string][]string)
+	}
+	e.cache[string(prefix)] = cands
+}
+
+func (e *ExecCompleter) run(line []rune, pos int, words []string, cword int) ([]string, error) {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+
+	prev := ""
+	if cword > 0 {
+		prev = words[cword-1]
+	}
+	args := append(append([]string{}, e.Args...), words[0], words[cword], prev)
+	cmd := exec.Command(e.Path, args...)
+	cmd.Env = append(os.Environ(), e.Env...)
+	cmd.Env = append(cmd.Env,
+		"COMP_LINE="+string(line),
+		// the offset in bytes like bash
+		"COMP_POINT="+strconv.Itoa(len(string(line[:pos]))),
+		"COMP_WORDS="+strings.Join(words, " "),
+		"COMP_CWORD="+strconv.Itoa(cword),
+		"COMP_TYPE="+strconv.Itoa(CharTab),
+		"COMP_KEY="+strconv.Itoa(CharTab),
+	)
+	output := bytes.NewBuffer(nil)
+	cmd.Stdout = output
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-timer.C:
+		// the children which keep stdout open are killed with it, and it
+		// isn't waited in case they can't be killed
+		killProcessGroup(cmd)
+		return nil, errExecCompleterTimeout
+	}
+
+	var cands []string
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		cand := strings.TrimRight(scanner.Text(), " \t\r")
+		if cand == "" {
+			continue
+		}
+		cands = append(cands, cand)
+	}
+	return cands, scanner.Err()
+}
+
+// split the line into words like COMP_WORDS, and return the index of the
+// word where the cursor is.
+func splitCompWords(line []rune) ([]string, int) {
+	words := strings.Fields(string(line))
+	if len(line) == 0 || line[len(line)-1] == ' ' || line[len(line)-1] == '\t' {
+		// a new word is going to be typed
+		words = append(words, "")
+	}
+	return words, len(words) - 1
+}
@@ -0,0 +1,83 @@
+package readline
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/chzyer/test"
+)
+
+func TestExecCompleter(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	defer test.New(t)
+
+	script := `
+if [ "$3" = "-o" ]; then
+	echo out.txt
+	exit
+fi
+echo "status"
+echo "stash"
+echo "show"
+`
+	c := NewExecCompleter(sh, "-c", script, "sh")
+
+	ret := []struct {
+		Line  string
+		Ret   []string
+		Share int
+	}{
+		{"git ", []string{"status ", "stash ", "show "}, 0},
+		{"git st", []string{"atus ", "ash "}, 2},
+		{"git sh", []string{"ow "}, 2},
+		{"git -o ", []string{"out.txt "}, 0},
+	}
+	for i, r := range ret {
+		newLine, length := c.Do([]rune(r.Line), len(r.Line))
+		test.Equal(rs(newLine), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(length, r.Share, fmt.Errorf("%v", i))
+	}
+
+	words, cword := splitCompWords([]rune("git commit -m"))
+	test.Equal(words, []string{"git", "commit", "-m"})
+	test.Equal(cword, 2)
+	words, cword = splitCompWords([]rune(""))
+	test.Equal(words, []string{""})
+	test.Equal(cword, 0)
+}
+
+func TestExecCompleterEnv(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	defer test.New(t)
+
+	// COMP_POINT is the offset in bytes
+	c := NewExecCompleter(sh, "-c", `echo "$2$COMP_POINT"`, "sh")
+	newLine, _ := c.Do([]rune("echo héllo wörld"), 16)
+	test.Equal(rs(newLine), []string{"18 "})
+}
+
+func TestExecCompleterTimeout(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	defer test.New(t)
+
+	// the child keeps stdout open after the program is killed
+	c := NewExecCompleter(sh, "-c", "sleep 5 & sleep 5", "sh")
+	c.Timeout = 50 * time.Millisecond
+	start := time.Now()
+	newLine, _ := c.Do([]rune("git "), 4)
+	test.Equal(len(newLine), 0)
+	if d := time.Since(start); d > time.Second {
+		t.Fatal("the completer isn't killed in time", d)
+	}
+}
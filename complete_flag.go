@@ -0,0 +1,292 @@
+package readline
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"sync"
+)
+
+// FlagCommand describes a command whose completion is generated from a
+// flag.FlagSet, the subcommands are nested by Commands.
+//
+// Example:
+//
+//	build := flag.NewFlagSet("build", flag.ContinueOnError)
+//	build.Bool("v", false, "print the names of packages")
+//	build.String("o", "", "output file")
+//
+//	completer := NewFlagCompleter(&FlagCommand{
+//		Commands: []*FlagCommand{
+//			{Name: "build", Usage: "compile packages", Flags: build},
+//		},
+//	})
+type FlagCommand struct {
+	Name  string
+	Usage string
+	Flags *flag.FlagSet
+
+	// Values specify the completer for the argument of a flag by its name,
+	// a flag without completer still accepts any value.
+	Values map[string]DynamicCompleteFunc
+
+	// complete the multi-letter flags as `--name` instead of `-name`
+	DoubleDash bool
+
+	// Args will be completed after the flags, they are the positional arguments.
+	Args     []PrefixCompleterInterface
+	Commands []*FlagCommand
+}
+
+// PcItem generates the prefix completer of the command, so it can be put
+// into any PrefixCompleter tree.
+func (c *FlagCommand) PcItem() *PrefixCompleter {
+	return PcItem(c.Name, c.items()...)
+}
+
+func (c *FlagCommand) flagName(name string) string {
+	if c.DoubleDash && len([]rune(name)) > 1 {
+		return "--" + name
+	}
+	return "-" + name
+}
+
+func (c *FlagCommand) items() []PrefixCompleterInterface {
+	var flags []*flagPcItem
+	if c.Flags != nil {
+		c.Flags.VisitAll(func(f *flag.Flag) {
+			name := c.flagName(f.Name)
+			if isBoolFlag(f) {
+				flags = append(flags, &flagPcItem{name: []rune(name + " "), usage: f.Usage})
+				return
+			}
+			complete := c.Values[f.Name]
+			flags = append(flags,
+				&flagPcItem{
+					name:  []rune(name + " "),
+					usage: f.Usage,
+					value: &flagValueItem{flag: name, complete: complete},
+				},
+				&flagPcItem{
+					name:  []rune(name + "="),
+					usage: f.Usage,
+					value: &flagValueItem{flag: name + "=", complete: complete},
+				},
+			)
+		})
+	}
+
+	items := make([]PrefixCompleterInterface, 0, len(flags)+len(c.Commands)+len(c.Args))
+	for _, f := range flags {
+		items = append(items, f)
+	}
+	for _, sub := range c.Commands {
+		items = append(items, sub.PcItem())
+	}
+	items = append(items, c.Args...)
+
+	// any flag can be followed by the others, so they share the same children.
+	for _, f := range flags {
+		if f.value == nil {
+			f.children = items
+			continue
+		}
+		f.value.children = items
+		f.children = []PrefixCompleterInterface{f.value}
+	}
+	return items
+}
+
+// return the command which the line is going to complete
+func (c *FlagCommand) lookup(line []rune) *FlagCommand {
+	words := strings.Fields(string(line))
+	if len(line) > 0 && line[len(line)-1] != ' ' && len(words) > 0 {
+		// the last word is still being typed
+		words = words[:len(words)-1]
+	}
+
+	cmd := c
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if strings.HasPrefix(word, "-") {
+			if cmd.takesValue(word) {
+				// the next word is the argument of the flag
+				i++
+			}
+			continue
+		}
+		for _, sub := range cmd.Commands {
+			if sub.Name == word {
+				cmd = sub
+				break
+			}
+		}
+	}
+	return cmd
+}
+
+// takesValue reports whether the flag word is followed by its argument,
+// which isn't given by `-name=value`
+func (c *FlagCommand) takesValue(word string) bool {
+	if c.Flags == nil || strings.ContainsRune(word, '=') {
+		return false
+	}
+	f := c.Flags.Lookup(strings.TrimLeft(word, "-"))
+	return f != nil && !isBoolFlag(f)
+}
+
+func (c *FlagCommand) describe(candidate string) string {
+	candidate = strings.TrimSpace(candidate)
+	if strings.HasPrefix(candidate, "-") {
+		if c.Flags == nil {
+			return ""
+		}
+		name := strings.TrimLeft(candidate, "-")
+		if idx := strings.IndexRune(name, '='); idx >= 0 {
+			name = name[:idx]
+		}
+		if f := c.Flags.Lookup(name); f != nil {
+			return f.Usage
+		}
+		return ""
+	}
+	for _, sub := range c.Commands {
+		if sub.Name == candidate {
+			return sub.Usage
+		}
+	}
+	return ""
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+// FlagCompleter is an AutoCompleter generated from the FlagCommand tree,
+// it describes the candidates by the usage of the flags and commands.
+type FlagCompleter struct {
+	*PrefixCompleter
+
+	root    *FlagCommand
+	m       sync.Mutex
+	current *FlagCommand
+}
+
+func NewFlagCompleter(root *FlagCommand) *FlagCompleter {
+	return &FlagCompleter{
+		PrefixCompleter: NewPrefixCompleter(root.items()...),
+		root:            root,
+		current:         root,
+	}
+}
+
+func (f *FlagCompleter) Do(line []rune, pos int) (newLine [][]rune, offset int) {
+	f.m.Lock()
+	f.current = f.root.lookup(line[:pos])
+	f.m.Unlock()
+	return f.PrefixCompleter.Do(line, pos)
+}
+
+func (f *FlagCompleter) Describe(candidate string) string {
+	f.m.Lock()
+	cmd := f.current
+	f.m.Unlock()
+	return cmd.describe(candidate)
+}
+
+// flagPcItem is a flag in the form of `-name ` or `-name=`
+type flagPcItem struct {
+	name     []rune
+	usage    string
+	value    *flagValueItem
+	children []PrefixCompleterInterface
+}
+
+// only print itself, the children are shared by the siblings
+func (p *flagPcItem) Print(prefix string, level int, buf *bytes.Buffer) {
+	name := strings.TrimSpace(string(p.name))
+	if p.usage != "" {
+		name += "  " + p.usage
+	}
+	Print(&PrefixCompleter{Name: []rune(name)}, prefix, level, buf)
+}
+
+func (p *flagPcItem) Do(line []rune, pos int) (newLine [][]rune, offset int) {
+	return Do(p, line, pos)
+}
+
+func (p *flagPcItem) GetName() []rune {
+	return p.name
+}
+
+func (p *flagPcItem) GetChildren() []PrefixCompleterInterface {
+	return p.children
+}
+
+func (p *flagPcItem) SetChildren(children []PrefixCompleterInterface) {
+	p.children = children
+}
+
+// flagValueItem completes the argument of a flag, besides the candidates of
+// the value completer, it also accepts the value which already typed.
+type flagValueItem struct {
+	flag     string
+	complete DynamicCompleteFunc
+	children []PrefixCompleterInterface
+}
+
+func (p *flagValueItem) Print(prefix string, level int, buf *bytes.Buffer) {}
+
+func (p *flagValueItem) Do(line []rune, pos int) (newLine [][]rune, offset int) {
+	return Do(p, line, pos)
+}
+
+func (p *flagValueItem) GetName() []rune {
+	return nil
+}
+
+func (p *flagValueItem) GetChildren() []PrefixCompleterInterface {
+	return p.children
+}
+
+func (p *flagValueItem) SetChildren(children []PrefixCompleterInterface) {
+	p.children = children
+}
+
+func (p *flagValueItem) IsDynamic() bool {
+	return true
+}
+
+func (p *flagValueItem) GetDynamicNames(line []rune) [][]rune {
+	var values []string
+	if p.complete != nil {
+		values = p.complete(string(line))
+	}
+
+	// the last word is still being typed, so it isn't a value yet
+	words := strings.Split(string(line), " ")
+	words = words[:len(words)-1]
+	for idx, word := range words {
+		if strings.HasSuffix(p.flag, "=") {
+			if strings.HasPrefix(word, p.flag) && len(word) > len(p.flag) {
+				values = append(values, word[len(p.flag):])
+			}
+		} else if word == p.flag && idx+1 < len(words) {
+			values = append(values, words[idx+1])
+		}
+	}
+
+	names := make([][]rune, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		names = append(names, []rune(value+" "))
+	}
+	return names
+}
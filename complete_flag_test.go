@@ -0,0 +1,109 @@
+package readline
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/chzyer/test"
+)
+
+func TestFlagCompleter(t *testing.T) {
+	defer test.New(t)
+
+	build := flag.NewFlagSet("build", flag.ContinueOnError)
+	build.Bool("v", false, "print the names of packages")
+	build.String("o", "", "output file")
+	build.String("tags", "", "build tags")
+
+	c := NewFlagCompleter(&FlagCommand{
+		Commands: []*FlagCommand{
+			{
+				Name:  "build",
+				Usage: "compile packages",
+				Flags: build,
+				Values: map[string]DynamicCompleteFunc{
+					"tags": func(string) []string { return []string{"netgo", "osusergo"} },
+				},
+				DoubleDash: true,
+			},
+		},
+	})
+
+	ret := []struct {
+		Line  string
+		Ret   []string
+		Share int
+	}{
+		{"bu", []string{"ild "}, 2},
+		{"build -", []string{"o ", "o=", "-tags ", "-tags=", "v "}, 1},
+		{"build -v ", []string{"-o ", "-o=", "--tags ", "--tags=", "-v "}, 0},
+		{"build --tags ", []string{"netgo ", "osusergo "}, 0},
+		{"build --tags n", []string{"etgo "}, 1},
+		{"build --tags=o", []string{"susergo "}, 1},
+		{"build --tags foo -", []string{"o ", "o=", "-tags ", "-tags=", "v "}, 1},
+		{"build -o out --tags=netgo -v", []string{" "}, 2},
+	}
+	for i, r := range ret {
+		newLine, length := c.Do([]rune(r.Line), len(r.Line))
+		test.Equal(rs(newLine), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(length, r.Share, fmt.Errorf("%v", i))
+	}
+
+	c.Do([]rune("build -"), 7)
+	test.Equal(c.Describe("-v"), "print the names of packages")
+	test.Equal(c.Describe("--tags="), "build tags")
+	test.Equal(c.Describe("-unknown"), "")
+	c.Do([]rune("b"), 1)
+	test.Equal(c.Describe("build"), "compile packages")
+}
+
+func TestFlagCompleterValue(t *testing.T) {
+	defer test.New(t)
+
+	root := flag.NewFlagSet("root", flag.ContinueOnError)
+	root.String("out", "", "output directory")
+	root.Bool("q", false, "quiet")
+	build := flag.NewFlagSet("build", flag.ContinueOnError)
+	build.Bool("v", false, "verbose")
+
+	cmd := &FlagCommand{
+		Flags:    root,
+		Commands: []*FlagCommand{{Name: "build", Usage: "compile", Flags: build}},
+	}
+	ret := []struct {
+		Line string
+		Cmd  string
+	}{
+		{"build ", "build"},
+		{"-out build ", ""},
+		{"-out=dir build ", "build"},
+		{"-q build ", "build"},
+		{"-out dir build ", "build"},
+	}
+	for i, r := range ret {
+		test.Equal(cmd.lookup([]rune(r.Line)).Name, r.Cmd, fmt.Errorf("%v", i))
+	}
+}
+
+func TestFlagCompleterGrid(t *testing.T) {
+	defer test.New(t)
+
+	build := flag.NewFlagSet("build", flag.ContinueOnError)
+	build.Bool("v", false, "print the names of packages")
+	build.String("o", "", "output file")
+
+	op := newTestOperation(&Config{
+		AutoComplete: NewFlagCompleter(&FlagCommand{
+			Commands: []*FlagCommand{{Name: "build", Flags: build}},
+		}),
+		FuncGetWidth: func() int { return 32 },
+	}, "build -", 7)
+	op.OnComplete()
+	// one candidate per row, followed by the description cut to the width
+	test.Equal(op.buf.below, []string{
+		"-o    \033[2moutput file\033[0m",
+		"-o=   \033[2moutput file\033[0m",
+		"-v    \033[2mprint the names of packag\033[0m",
+	})
+}
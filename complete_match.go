@@ -0,0 +1,181 @@
+package readline
+
+import (
+	"sort"
+	"unicode"
+)
+
+// the ways of matching the typed word with the candidates, see Config.CompleteMatch
+const (
+	// the candidates are what the AutoCompleter returns
+	CompleteMatchPrefix = iota
+	// the candidates contain the typed word
+	CompleteMatchSubstring
+	// the typed word is a subsequence of the candidates, like `stcfg` for `set-config`
+	CompleteMatchFuzzy
+)
+
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	bonusBoundary    = 8
+	bonusConsecutive = 4
+	bonusFirstChar   = 2
+)
+
+type matchedCandidate struct {
+	cand  []rune
+	score int
+	pos   []int
+}
+
+// matchCandidates filters the candidates which match the word in the mode,
+// and sorts them by score, the candidates in the same score keep their order.
+// It returns the matched candidates and the positions of the matched runes.
+func matchCandidates(mode int, word []rune, cands [][]rune) ([][]rune, [][]int) {
+	matched := make([]matchedCandidate, 0, len(cands))
+	for _, cand := range cands {
+		var (
+			score int
+			pos   []int
+			ok    bool
+		)
+		switch mode {
+		case CompleteMatchSubstring:
+			score, pos, ok = substringMatch(word, cand)
+		case CompleteMatchFuzzy:
+			score, pos, ok = fuzzyMatch(word, cand)
+		default:
+			ok = runes.HasPrefixFold(cand, word)
+			for i := range word {
+				pos = append(pos, i)
+			}
+		}
+		if ok {
+			matched = append(matched, matchedCandidate{cand, score, pos})
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].score > matched[j].score
+	})
+	ret := make([][]rune, len(matched))
+	pos := make([][]int, len(matched))
+	for idx, m := range matched {
+		ret[idx] = m.cand
+		pos[idx] = m.pos
+	}
+	return ret, pos
+}
+
+func equalRuneFold(a, b rune) bool {
+	return a == b || unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+// the rune at idx starts a word, like `c` in `set-config` or `C` in `setConfig`
+func isWordBoundary(rs []rune, idx int) bool {
+	if idx == 0 {
+		return true
+	}
+	prev, cur := rs[idx-1], rs[idx]
+	if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+		return unicode.IsLetter(cur) || unicode.IsDigit(cur)
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
+
+func substringMatch(word, cand []rune) (score int, pos []int, ok bool) {
+	if len(word) == 0 {
+		return 0, nil, true
+	}
+	best := -1
+	for i := 0; i+len(word) <= len(cand); i++ {
+		found := true
+		for j := range word {
+			if !equalRuneFold(cand[i+j], word[j]) {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		s := len(word)*scoreMatch - i
+		if isWordBoundary(cand, i) {
+			s += bonusBoundary
+		}
+		if best < 0 || s > score {
+			best, score = i, s
+		}
+	}
+	if best < 0 {
+		return 0, nil, false
+	}
+	for i := range word {
+		pos = append(pos, best+i)
+	}
+	return score, pos, true
+}
+
+func fuzzyMatch(word, cand []rune) (score int, pos []int, ok bool) {
+	if len(word) == 0 {
+		return 0, nil, true
+	}
+
+	// find where the first occurrence of the whole subsequence ends
+	end, wi := -1, 0
+	for i := 0; i < len(cand); i++ {
+		if equalRuneFold(cand[i], word[wi]) {
+			wi++
+			if wi == len(word) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	// and scan backward to narrow the start
+	start, wi := end, len(word)-1
+	for i := end; i >= 0; i-- {
+		if equalRuneFold(cand[i], word[wi]) {
+			wi--
+			if wi < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	pos = make([]int, 0, len(word))
+	wi = 0
+	for i := start; i <= end && wi < len(word); i++ {
+		if equalRuneFold(cand[i], word[wi]) {
+			pos = append(pos, i)
+			wi++
+		}
+	}
+
+	for idx, p := range pos {
+		score += scoreMatch
+		if isWordBoundary(cand, p) {
+			score += bonusBoundary
+			if idx == 0 {
+				score += bonusFirstChar * bonusBoundary
+			}
+		}
+		if idx == 0 {
+			continue
+		}
+		if gap := p - pos[idx-1] - 1; gap == 0 {
+			score += bonusConsecutive
+		} else {
+			score += scoreGapStart + scoreGapExtension*(gap-1)
+		}
+	}
+	return score, pos, true
+}
@@ -0,0 +1,47 @@
+package readline
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chzyer/test"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Word string
+		Cand string
+		Pos  []int
+		Ok   bool
+	}{
+		{"stcfg", "set-config", []int{0, 2, 4, 7, 9}, true},
+		{"sc", "set-config", []int{0, 4}, true},
+		{"SC", "setConfig", []int{0, 3}, true},
+		{"gfc", "set-config", nil, false},
+		{"cfg", "cfg", []int{0, 1, 2}, true},
+	}
+	for i, r := range ret {
+		_, pos, ok := fuzzyMatch([]rune(r.Word), []rune(r.Cand))
+		test.Equal(ok, r.Ok, fmt.Errorf("%v", i))
+		test.Equal(pos, r.Pos, fmt.Errorf("%v", i))
+	}
+}
+
+func TestMatchCandidates(t *testing.T) {
+	defer test.New(t)
+
+	cands := sr("status ", "set-config ", "show-config ", "stash ")
+
+	ret, pos := matchCandidates(CompleteMatchFuzzy, []rune("sc"), cands)
+	test.Equal(rs(ret), []string{"set-config ", "show-config "})
+	test.Equal(pos[0], []int{0, 4})
+
+	ret, pos = matchCandidates(CompleteMatchSubstring, []rune("config"), cands)
+	test.Equal(rs(ret), []string{"set-config ", "show-config "})
+	test.Equal(pos[0], []int{4, 5, 6, 7, 8, 9})
+
+	ret, _ = matchCandidates(CompleteMatchSubstring, []rune("ta"), cands)
+	test.Equal(rs(ret), []string{"status ", "stash "})
+}
@@ -0,0 +1,94 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/test"
+)
+
+func TestCompleteMenu(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Keys string
+		Line string
+	}{
+		{"st\t\r", "start "},
+		{"st\t\t\r", "status "},
+		// cycled back to the first one
+		{"st\t\t\t\t\r", "start "},
+		{"st\t\033[Z\r", "stop "},
+		{"st\t\t\t\033[Z\r", "status "},
+		// Ctrl-G restores the original word
+		{"st\t\t\a\r", "st"},
+		// the other key accepts the candidate and is processed
+		{"st\t\tx\r", "status x"},
+		{"st\t\t\x08\r", "status"},
+	}
+	for i, r := range ret {
+		line, err := readTestLine(&Config{
+			AutoComplete: NewPrefixCompleter(
+				PcItem("start"), PcItem("status"), PcItem("stop"),
+			),
+			CompleteStyle: CompleteStyleMenu,
+		}, r.Keys)
+		test.Nil(err)
+		test.Equal(line, r.Line, fmt.Errorf("%v", i))
+	}
+}
+
+// describedCompleter describes the candidates by descs
+type describedCompleter struct {
+	*PrefixCompleter
+	descs map[string]string
+}
+
+func (c *describedCompleter) Describe(candidate string) string {
+	return c.descs[candidate]
+}
+
+func TestCompletePreview(t *testing.T) {
+	defer test.New(t)
+
+	long := ""
+	for i := 0; i < completePreviewMaxLines+5; i++ {
+		long += fmt.Sprintf("line %d\n", i)
+	}
+	op := newTestOperation(&Config{
+		AutoComplete: &describedCompleter{
+			PrefixCompleter: NewPrefixCompleter(PcItem("start"), PcItem("stop")),
+			descs: map[string]string{
+				"start": "start the service\nin the background",
+				"stop":  long,
+			},
+		},
+		ForceUseInteractive: true,
+		FuncGetWidth:        func() int { return 30 },
+	}, "st", 2)
+	rule := "\033[2m" + strings.Repeat("─", 29) + "\033[0m"
+
+	// the first Tab lists the candidates without preview
+	op.OnComplete()
+	test.Equal(op.buf.below, []string{
+		"start    \033[2mstart the service\033[0m",
+		"stop     \033[2mline 0\033[0m",
+	})
+
+	// the preview follows the selected candidate
+	op.OnComplete()
+	test.Equal(op.buf.below[2:], []string{rule, "start the service", "in the background"})
+	op.HandleCompleteSelect(CharTab)
+	preview := op.buf.below[3:]
+	test.Equal(len(preview), completePreviewMaxLines)
+	test.Equal(preview[0], "line 0")
+	test.Equal(preview[completePreviewMaxLines-1], fmt.Sprintf("line %d", completePreviewMaxLines-1))
+
+	// the rows are cleared when the completion ends
+	op.HandleCompleteSelect(CharEnter)
+	// refreshed by ioloop after the key
+	op.buf.Refresh(nil)
+	test.Equal(len(op.buf.below), 0)
+	test.Equal(frameRows(op.buf.screen), []string{"stop "})
+}
@@ -0,0 +1,181 @@
+package readline
+
+import "unicode"
+
+// constrain returns buf with s inserted at idx and the cursor after it,
+// the runes which break Config.MaxRunes, FuncAllowRune or InputMask are
+// dropped, ok is false if any of them is dropped.
+func (r *RuneBuffer) constrain(buf []rune, idx int, s []rune) (newBuf []rune, newIdx int, ok bool) {
+	if r.cfg.InputMask != "" {
+		return r.constrainMask(buf, idx, s)
+	}
+	ok = true
+	accepted := make([]rune, 0, len(s))
+	for _, c := range s {
+		if !r.allowRune(c) || r.cfg.MaxRunes > 0 && len(buf)+len(accepted) >= r.cfg.MaxRunes {
+			ok = false
+			continue
+		}
+		accepted = append(accepted, c)
+	}
+	newBuf = make([]rune, 0, len(buf)+len(accepted))
+	newBuf = append(newBuf, buf[:idx]...)
+	newBuf = append(newBuf, accepted...)
+	newBuf = append(newBuf, buf[idx:]...)
+	return newBuf, idx + len(accepted), ok
+}
+
+// allowLine reports whether the whole line keeps Config.MaxRunes,
+// FuncAllowRune and InputMask, it checks the text which replaces the line
+// instead of being inserted.
+func (r *RuneBuffer) allowLine(line []rune) bool {
+	if r.cfg.MaxRunes > 0 && len(line) > r.cfg.MaxRunes {
+		return false
+	}
+	data := line
+	if r.cfg.InputMask != "" {
+		mask := []rune(r.cfg.InputMask)
+		data = make([]rune, 0, len(line))
+		for _, c := range line {
+			if !isMaskSeparator(mask, c) {
+				data = append(data, c)
+			}
+		}
+		if formatted, ok := formatMask(mask, data); !ok || !runes.Equal(formatted, line) {
+			return false
+		}
+	}
+	for _, c := range data {
+		if !r.allowRune(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *RuneBuffer) allowRune(c rune) bool {
+	return r.cfg.FuncAllowRune == nil || r.cfg.FuncAllowRune(c)
+}
+
+// constrainMask puts the runes into the slots of Config.InputMask, the
+// separators typed are dropped since they're put by the mask
+func (r *RuneBuffer) constrainMask(buf []rune, idx int, s []rune) ([]rune, int, bool) {
+	mask := []rune(r.cfg.InputMask)
+	// the runes in the slots, and the count of them before the cursor
+	data := make([]rune, 0, len(buf)+len(s))
+	pos := 0
+	for i, c := range buf {
+		if isMaskSeparator(mask, c) {
+			continue
+		}
+		if i < idx {
+			pos++
+		}
+		data = append(data, c)
+	}
+	start, ok := pos, true
+	for _, c := range s {
+		if isMaskSeparator(mask, c) {
+			continue
+		}
+		next := make([]rune, 0, len(data)+1)
+		next = append(next, data[:pos]...)
+		next = append(next, c)
+		next = append(next, data[pos:]...)
+		line, fit := formatMask(mask, next)
+		if !r.allowRune(c) || !fit || r.cfg.MaxRunes > 0 && len(line) > r.cfg.MaxRunes {
+			ok = false
+			continue
+		}
+		data = next
+		pos++
+	}
+	if pos == start {
+		return buf, idx, ok
+	}
+	line, _ := formatMask(mask, data)
+	// the cursor is after the last rune inserted
+	return line, maskIndex(mask, line, pos), ok
+}
+
+// reflowMask lays out the runes left in buf into the slots of
+// Config.InputMask again after some of them are removed, the cursor at idx
+// moves with the runes before it. ok is false if they don't fit.
+func (r *RuneBuffer) reflowMask(buf []rune, idx int) (line []rune, newIdx int, ok bool) {
+	if r.cfg.InputMask == "" {
+		return buf, idx, true
+	}
+	mask := []rune(r.cfg.InputMask)
+	data := make([]rune, 0, len(buf))
+	pos := 0
+	for i, c := range buf {
+		if isMaskSeparator(mask, c) {
+			continue
+		}
+		if i < idx {
+			pos++
+		}
+		data = append(data, c)
+	}
+	if line, ok = formatMask(mask, data); !ok {
+		return buf, idx, false
+	}
+	return line, maskIndex(mask, line, pos), true
+}
+
+// setLine replaces the line by buf with the cursor at idx, the line is
+// kept if buf breaks Config.MaxRunes, FuncAllowRune or InputMask.
+func (r *RuneBuffer) setLine(buf []rune, idx int) bool {
+	if !r.allowLine(buf) {
+		return false
+	}
+	r.buf, r.idx = buf, idx
+	return true
+}
+
+// maskIndex returns the index after the first n runes in the slots of line
+func maskIndex(mask, line []rune, n int) int {
+	idx := 0
+	for ; n > 0; idx++ {
+		if !isMaskSeparator(mask, line[idx]) {
+			n--
+		}
+	}
+	return idx
+}
+
+// formatMask lays out data into the slots of mask, the separators are put
+// before the slots which are filled. ok is false if data doesn't fit.
+func formatMask(mask, data []rune) (line []rune, ok bool) {
+	for _, m := range mask {
+		if len(data) == 0 {
+			break
+		}
+		switch m {
+		case '#':
+			if !unicode.IsDigit(data[0]) {
+				return nil, false
+			}
+		case '@':
+			if !unicode.IsLetter(data[0]) {
+				return nil, false
+			}
+		case '*':
+		default:
+			line = append(line, m)
+			continue
+		}
+		line = append(line, data[0])
+		data = data[1:]
+	}
+	return line, len(data) == 0
+}
+
+func isMaskSeparator(mask []rune, c rune) bool {
+	for _, m := range mask {
+		if m != '#' && m != '@' && m != '*' && m == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package readline
+
+import (
+	"fmt"
+	"testing"
+	"unicode"
+
+	"github.com/chzyer/test"
+)
+
+func TestConstrain(t *testing.T) {
+	defer test.New(t)
+
+	isHex := func(r rune) bool {
+		return unicode.Is(unicode.ASCII_Hex_Digit, r)
+	}
+	ret := []struct {
+		Cfg  Config
+		Line string
+		Idx  int
+		Keys string
+		Ret  string
+		Pos  int
+		Ok   bool
+	}{
+		{Config{}, "ab", 1, "xy", "axyb", 3, true},
+		{Config{MaxRunes: 4}, "ab", 2, "cde", "abcd", 4, false},
+		{Config{MaxRunes: 4}, "abcd", 0, "x", "abcd", 0, false},
+		{Config{FuncAllowRune: isHex}, "", 0, "0xfg 1", "0f1", 3, false},
+		{Config{FuncAllowRune: unicode.IsDigit, MaxRunes: 3}, "1", 1, "a234", "123", 3, false},
+		{Config{InputMask: "####-##-##"}, "", 0, "20240", "2024-0", 6, true},
+		{Config{InputMask: "####-##-##"}, "", 0, "2024-01-02", "2024-01-02", 10, true},
+		{Config{InputMask: "####-##-##"}, "2024-01-02", 10, "3", "2024-01-02", 10, false},
+		{Config{InputMask: "####-##-##"}, "2024", 4, "x1", "2024-1", 6, false},
+		// the runes after the cursor move to the next slots
+		{Config{InputMask: "####-##-##"}, "2024-0", 2, "19", "2019-24-0", 4, true},
+		{Config{InputMask: "(###) ###-####"}, "", 0, "5551234", "(555) 123-4", 11, true},
+		{Config{InputMask: "@@-###"}, "a", 1, "1b2", "ab-2", 4, false},
+		{Config{InputMask: "####-##-##", MaxRunes: 7}, "", 0, "2024012", "2024-01", 7, false},
+	}
+	for i, r := range ret {
+		rb := newTestRuneBuffer(r.Line, r.Idx)
+		cfg := r.Cfg
+		cfg.Stdout = rb.cfg.Stdout
+		cfg.FuncIsTerminal = rb.cfg.FuncIsTerminal
+		rb.SetConfig(&cfg)
+		ok := rb.Insert([]rune(r.Keys))
+		test.Equal(string(rb.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(rb.Pos(), r.Pos, fmt.Errorf("%v", i))
+		test.Equal(ok, r.Ok, fmt.Errorf("%v", i))
+	}
+}
+
+func TestConstrainYank(t *testing.T) {
+	defer test.New(t)
+
+	rb := newTestRuneBuffer("2024-01", 7)
+	rb.cfg.InputMask = "####-##-##"
+	rb.KillFront()
+	test.Equal(rb.Yank(), true)
+	test.Equal(string(rb.Runes()), "2024-01")
+	test.Equal(rb.Yank(), false)
+	test.Equal(string(rb.Runes()), "2024-01-20")
+}
+
+func TestConstrainEdit(t *testing.T) {
+	defer test.New(t)
+
+	const date = "####-##-##"
+	ret := []struct {
+		Mask  string
+		Allow func(rune) bool
+		Line  string
+		Idx   int
+		Op    func(*RuneBuffer)
+		Ret   string
+		Pos   int
+	}{
+		{date, nil, "2024-01", 5, (*RuneBuffer).Transpose, "2024-01", 5},
+		{"@@-##", nil, "ab-12", 5, func(rb *RuneBuffer) { rb.TransposeWords() }, "ab-12", 5},
+		{"##-##", nil, "12-34", 5, func(rb *RuneBuffer) { rb.TransposeWords() }, "34-12", 5},
+		{"", unicode.IsLower, "abc def", 0, (*RuneBuffer).UpcaseWord, "abc def", 0},
+		{"", unicode.IsLower, "abc def", 0, (*RuneBuffer).CapitalizeWord, "abc def", 0},
+		// the runes left are reflowed into the slots
+		{date, nil, "2024-01-02", 5, (*RuneBuffer).Backspace, "2024-01-02", 4},
+		{date, nil, "2024-01-02", 2, func(rb *RuneBuffer) { rb.Delete() }, "2040-10-2", 2},
+		{date, nil, "2024-01-02", 7, (*RuneBuffer).BackEscapeWord, "2024-02", 4},
+		{date, nil, "2024-01", 5, (*RuneBuffer).Kill, "2024", 4},
+		{date, nil, "2024-01", 5, (*RuneBuffer).KillFront, "01", 0},
+		// the letter can't move to the slot of digit
+		{"@@-###", nil, "ab-12", 1, (*RuneBuffer).Backspace, "ab-12", 1},
+	}
+	for i, r := range ret {
+		rb := newTestRuneBuffer(r.Line, r.Idx)
+		rb.cfg.InputMask = r.Mask
+		rb.cfg.FuncAllowRune = r.Allow
+		r.Op(rb)
+		test.Equal(string(rb.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(rb.Pos(), r.Pos, fmt.Errorf("%v", i))
+	}
+
+	// vim >>
+	noSpace := func(r rune) bool { return r != ' ' }
+	for i, cfg := range []Config{{MaxRunes: 5}, {FuncAllowRune: noSpace}} {
+		o := newTestVim("abc", 0)
+		o.op.cfg.MaxRunes = cfg.MaxRunes
+		o.op.cfg.FuncAllowRune = cfg.FuncAllowRune
+		feedVim(o, ">>")
+		test.Equal(string(o.op.buf.Runes()), "abc", fmt.Errorf("%v", i))
+	}
+}
+
+func TestConstrainPaths(t *testing.T) {
+	defer test.New(t)
+
+	toLetter, toDigit := sedEditor(t, "s/1/a/"), sedEditor(t, "s/1/4/")
+	noSpace := func(r rune) bool { return r != ' ' }
+	ret := []struct {
+		Cfg  func() *Config
+		Keys string
+		Line string
+	}{
+		// the candidate
+		{func() *Config {
+			return &Config{AutoComplete: NewPrefixCompleter(PcItem("show")), FuncAllowRune: noSpace}
+		}, "sho\t\r", "show"},
+		// the candidate of the menu
+		{func() *Config {
+			return &Config{
+				AutoComplete:  NewPrefixCompleter(PcItem("start"), PcItem("stop")),
+				CompleteStyle: CompleteStyleMenu,
+				FuncAllowRune: noSpace,
+			}
+		}, "st\t\t\r", "stop"},
+		// vim R and r
+		{func() *Config {
+			return &Config{VimMode: true, FuncAllowRune: unicode.IsDigit}
+		}, "123\0330Rab\033\r", "123"},
+		{func() *Config {
+			return &Config{VimMode: true, FuncAllowRune: unicode.IsDigit}
+		}, "123\0330R4a\033\r", "423"},
+		{func() *Config {
+			return &Config{VimMode: true, FuncAllowRune: unicode.IsDigit}
+		}, "123\033ra\r", "123"},
+		{func() *Config {
+			return &Config{VimMode: true, FuncAllowRune: unicode.IsLower}
+		}, "ab\0330~\r", "ab"},
+		// the insert repeated by `.`
+		{func() *Config {
+			return &Config{VimMode: true, MaxRunes: 3}
+		}, "\033i12\033.\r", "112"},
+		// Ctrl-A
+		{func() *Config {
+			return &Config{VimMode: true, MaxRunes: 1}
+		}, "9\033\x01\r", "9"},
+		{func() *Config {
+			return &Config{VimMode: true, MaxRunes: 1}
+		}, "8\033\x01\r", "9"},
+		// the editor
+		{func() *Config {
+			return &Config{Editor: toLetter, FuncAllowRune: unicode.IsDigit}
+		}, "123\x18\x05\r", "123"},
+		{func() *Config {
+			return &Config{Editor: toDigit, FuncAllowRune: unicode.IsDigit}
+		}, "123\x18\x05\r", "423"},
+	}
+	for i, r := range ret {
+		line, err := readTestLine(r.Cfg(), r.Keys)
+		test.Nil(err)
+		test.Equal(line, r.Line, fmt.Errorf("%v", i))
+	}
+}
@@ -0,0 +1,104 @@
+package readline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var errEditorNotAllowed = errors.New("the edited line isn't allowed")
+
+// handleCtrlX reads the key after Ctrl-X, Ctrl-X Ctrl-E edits the line in
+// the editor. It returns CharEnter if the line should be submitted.
+func (o *Operation) handleCtrlX() rune {
+	// the terminal stops reading after the key so that the editor gets
+	// all the keys, kick it unless the line is submitted
+	if r := o.t.ReadRuneAndPause(); r != CharLineEnd {
+		o.t.KickRead()
+		o.t.Bell()
+		return 0
+	}
+	return o.runEditor()
+}
+
+// isVimEditorMode reports whether the next key may be `v` which edits the
+// line in the normal mode of vim by Config.VimEditorKey.
+func (o *Operation) isVimEditorMode() bool {
+	return o.GetConfig().VimEditorKey && o.IsEnableVimMode() &&
+		o.opVim.vimMode == VIM_NORMAL && !o.IsSearchMode() && !o.IsInCompleteMode()
+}
+
+// runEditor edits the line in the editor while the terminal waits, and
+// kicks the terminal unless the line should be submitted.
+func (o *Operation) runEditor() rune {
+	if err := o.editLine(); err != nil {
+		o.t.Bell()
+	} else if o.GetConfig().EditorSubmit {
+		return CharEnter
+	}
+	o.t.KickRead()
+	return 0
+}
+
+// editLine writes the line to a temp file and opens it in the editor,
+// the line is replaced by the content of the file after the editor exits,
+// unless it breaks Config.MaxRunes, FuncAllowRune or InputMask.
+func (o *Operation) editLine() error {
+	f, err := ioutil.TempFile("", "readline-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(string(o.buf.Runes()))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	o.buf.Clean()
+	o.t.ExitRawMode()
+	err = o.editorCommand(f.Name()).Run()
+	o.t.EnterRawMode()
+	if err != nil {
+		o.Refresh()
+		return err
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		o.Refresh()
+		return err
+	}
+	// most editors end the file with a newline
+	line := []rune(strings.TrimRight(string(data), "\r\n"))
+	if !o.buf.allowLine(line) {
+		o.Refresh()
+		return errEditorNotAllowed
+	}
+	o.buf.Set(line)
+	return nil
+}
+
+// editorCommand runs Config.Editor, $VISUAL or $EDITOR on the terminal,
+// vi is used if none of them is set
+func (o *Operation) editorCommand(path string) *exec.Cmd {
+	editor := o.GetConfig().Editor
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor == "" {
+			editor = os.Getenv(env)
+		}
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
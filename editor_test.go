@@ -0,0 +1,107 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/chzyer/test"
+)
+
+func TestEditLine(t *testing.T) {
+	defer test.New(t)
+
+	cfg := &Config{Editor: sedEditor(t, "s/world/readline/")}
+	op := newTestOperation(cfg, "hello world", 0)
+	rb := op.buf
+	test.Nil(op.editLine())
+	test.Equal(string(rb.Runes()), "hello readline")
+	test.Equal(rb.Pos(), rb.Len())
+
+	cfg.Editor = "false"
+	test.NotNil(op.editLine())
+	test.Equal(string(rb.Runes()), "hello readline")
+}
+
+func TestEditLineKeys(t *testing.T) {
+	defer test.New(t)
+
+	editor := sedEditor(t, "s/a/b/")
+	ret := []struct {
+		Keys      string
+		Vim       bool
+		EditorKey bool
+		Line      string
+	}{
+		// the terminal keeps reading unless the editor is opened
+		{"abc\x18\x18\x05\n", false, false, "abc"},
+		{"x = 9\033\x18\x05\n", true, false, "x = 8"},
+		{"abc\x18\x05d\n", false, false, "bbcd"},
+		{"abc\x18\x05d\n", true, false, "bbcd"},
+		// `v` in the normal mode
+		{"abc\033vAd\n", true, true, "bbcd"},
+		{"abc\033vd\n", true, false, "ab"},
+		// the terminal goes on after the other `v`
+		{"av\033fvx2vrv\"vyl\n", true, true, "v"},
+		{"abc\033vAv\n", true, true, "bbcv"},
+	}
+	for i, r := range ret {
+		done := make(chan string, 1)
+		go func() {
+			line, _ := readTestLine(&Config{
+				Editor:       editor,
+				VimMode:      r.Vim,
+				VimEditorKey: r.EditorKey,
+			}, r.Keys)
+			done <- line
+		}()
+		select {
+		case line := <-done:
+			test.Equal(line, r.Line, fmt.Errorf("%v", i))
+		case <-time.After(5 * time.Second):
+			t.Fatal("the terminal stops reading", i)
+		}
+	}
+}
+
+// the terminal doesn't read after the line is submitted
+func TestVimEditorKeyPause(t *testing.T) {
+	defer test.New(t)
+
+	for i, vim := range []bool{false, true} {
+		typed := []string{"a", "v", "\r"}
+		if vim {
+			// `v` in the normal mode starts the editor which fails
+			typed = []string{"a", "v", "\033", "v", "\r"}
+		}
+		stdin, keys := io.Pipe()
+		rl, err := NewEx(testConfig(&Config{
+			Stdin:        stdin,
+			VimMode:      vim,
+			VimEditorKey: true,
+			Editor:       "false",
+		}))
+		test.Nil(err)
+		go func() {
+			for _, key := range typed {
+				keys.Write([]byte(key))
+			}
+		}()
+		line, err := rl.Readline()
+		test.Nil(err)
+		test.Equal(line, "av", fmt.Errorf("%v", i))
+
+		read := make(chan struct{})
+		go func() {
+			keys.Write([]byte("X"))
+			close(read)
+		}()
+		select {
+		case <-read:
+			t.Fatal("the key after Enter is read", i)
+		case <-time.After(100 * time.Millisecond):
+		}
+		rl.Close()
+	}
+}
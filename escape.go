@@ -0,0 +1,64 @@
+package readline
+
+const (
+	// the runes between them don't take space on the screen, like the
+	// \[ and \] of bash's PS1
+	CharIgnoreStart = '\001'
+	CharIgnoreEnd   = '\002'
+)
+
+// escapeLen returns the length of the escape sequence at the start of rs,
+// which is a CSI like the colors, an OSC like the titles and hyperlinks
+// ended by BEL or ST, or ESC followed by one rune.
+func escapeLen(rs []rune) int {
+	if len(rs) < 2 {
+		return len(rs)
+	}
+	switch rs[1] {
+	case '[':
+		for i := 2; i < len(rs); i++ {
+			if rs[i] >= 0x40 && rs[i] <= 0x7E {
+				return i + 1
+			}
+		}
+		return len(rs)
+	case ']', 'P', '_', '^':
+		for i := 2; i < len(rs); i++ {
+			if rs[i] == '\a' {
+				return i + 1
+			}
+			if rs[i] == '\033' && i+1 < len(rs) && rs[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(rs)
+	}
+	return 2
+}
+
+// isSGR reports whether the escape sequence sets the colors or attributes
+func isSGR(seq []rune) bool {
+	return len(seq) > 2 && seq[1] == '[' && seq[len(seq)-1] == 'm'
+}
+
+// hyperlink returns the target of an OSC 8 hyperlink, an empty target
+// ends the link
+func hyperlink(seq []rune) (target string, ok bool) {
+	if len(seq) < 4 || seq[1] != ']' || seq[2] != '8' || seq[3] != ';' {
+		return "", false
+	}
+	// OSC 8 ; params ; URI ST
+	body := seq[4:]
+	for i, r := range body {
+		if r == ';' {
+			body = body[i+1:]
+			break
+		}
+	}
+	if n := len(body); n > 0 && body[n-1] == '\a' {
+		body = body[:n-1]
+	} else if n > 1 && body[n-2] == '\033' && body[n-1] == '\\' {
+		body = body[:n-2]
+	}
+	return string(body), true
+}
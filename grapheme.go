@@ -0,0 +1,370 @@
+package readline
+
+import (
+	"unicode"
+)
+
+// the runes in East Asian Width Wide (W) and Fullwidth (F), which take two
+// columns in the terminal
+var eastAsianWide = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115F, 1},
+		{0x231A, 0x231B, 1},
+		{0x2329, 0x232A, 1},
+		{0x23E9, 0x23EC, 1},
+		{0x23F0, 0x23F0, 1},
+		{0x23F3, 0x23F3, 1},
+		{0x25FD, 0x25FE, 1},
+		{0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1},
+		{0x267F, 0x267F, 1},
+		{0x2693, 0x2693, 1},
+		{0x26A1, 0x26A1, 1},
+		{0x26AA, 0x26AB, 1},
+		{0x26BD, 0x26BE, 1},
+		{0x26C4, 0x26C5, 1},
+		{0x26CE, 0x26CE, 1},
+		{0x26D4, 0x26D4, 1},
+		{0x26EA, 0x26EA, 1},
+		{0x26F2, 0x26F3, 1},
+		{0x26F5, 0x26F5, 1},
+		{0x26FA, 0x26FA, 1},
+		{0x26FD, 0x26FD, 1},
+		{0x2705, 0x2705, 1},
+		{0x270A, 0x270B, 1},
+		{0x2728, 0x2728, 1},
+		{0x274C, 0x274C, 1},
+		{0x274E, 0x274E, 1},
+		{0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1},
+		{0x2795, 0x2797, 1},
+		{0x27B0, 0x27B0, 1},
+		{0x27BF, 0x27BF, 1},
+		{0x2B1B, 0x2B1C, 1},
+		{0x2B50, 0x2B50, 1},
+		{0x2B55, 0x2B55, 1},
+		{0x2E80, 0x2E99, 1},
+		{0x2E9B, 0x2EF3, 1},
+		{0x2F00, 0x2FD5, 1},
+		{0x2FF0, 0x2FFB, 1},
+		{0x3000, 0x303E, 1},
+		{0x3041, 0x3096, 1},
+		{0x3099, 0x30FF, 1},
+		{0x3105, 0x312F, 1},
+		{0x3131, 0x318E, 1},
+		{0x3190, 0x31E3, 1},
+		{0x31F0, 0x321E, 1},
+		{0x3220, 0x3247, 1},
+		{0x3250, 0x4DBF, 1},
+		{0x4E00, 0xA48C, 1},
+		{0xA490, 0xA4C6, 1},
+		{0xA960, 0xA97C, 1},
+		{0xAC00, 0xD7A3, 1},
+		{0xF900, 0xFAFF, 1},
+		{0xFE10, 0xFE19, 1},
+		{0xFE30, 0xFE52, 1},
+		{0xFE54, 0xFE66, 1},
+		{0xFE68, 0xFE6B, 1},
+		{0xFF01, 0xFF60, 1},
+		{0xFFE0, 0xFFE6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16FE0, 0x16FE4, 1},
+		{0x16FF0, 0x16FF1, 1},
+		{0x17000, 0x187F7, 1},
+		{0x18800, 0x18CD5, 1},
+		{0x18D00, 0x18D08, 1},
+		{0x1AFF0, 0x1AFF3, 1},
+		{0x1AFF5, 0x1AFFB, 1},
+		{0x1AFFD, 0x1AFFE, 1},
+		{0x1B000, 0x1B122, 1},
+		{0x1B132, 0x1B132, 1},
+		{0x1B150, 0x1B152, 1},
+		{0x1B155, 0x1B155, 1},
+		{0x1B164, 0x1B167, 1},
+		{0x1B170, 0x1B2FB, 1},
+		{0x1F004, 0x1F004, 1},
+		{0x1F0CF, 0x1F0CF, 1},
+		{0x1F18E, 0x1F18E, 1},
+		{0x1F191, 0x1F19A, 1},
+		{0x1F200, 0x1F202, 1},
+		{0x1F210, 0x1F23B, 1},
+		{0x1F240, 0x1F248, 1},
+		{0x1F250, 0x1F251, 1},
+		{0x1F260, 0x1F265, 1},
+		{0x1F300, 0x1F320, 1},
+		{0x1F32D, 0x1F335, 1},
+		{0x1F337, 0x1F37C, 1},
+		{0x1F37E, 0x1F393, 1},
+		{0x1F3A0, 0x1F3CA, 1},
+		{0x1F3CF, 0x1F3D3, 1},
+		{0x1F3E0, 0x1F3F0, 1},
+		{0x1F3F4, 0x1F3F4, 1},
+		{0x1F3F8, 0x1F43E, 1},
+		{0x1F440, 0x1F440, 1},
+		{0x1F442, 0x1F4FC, 1},
+		{0x1F4FF, 0x1F53D, 1},
+		{0x1F54B, 0x1F54E, 1},
+		{0x1F550, 0x1F567, 1},
+		{0x1F57A, 0x1F57A, 1},
+		{0x1F595, 0x1F596, 1},
+		{0x1F5A4, 0x1F5A4, 1},
+		{0x1F5FB, 0x1F64F, 1},
+		{0x1F680, 0x1F6C5, 1},
+		{0x1F6CC, 0x1F6CC, 1},
+		{0x1F6D0, 0x1F6D2, 1},
+		{0x1F6D5, 0x1F6D7, 1},
+		{0x1F6DC, 0x1F6DF, 1},
+		{0x1F6EB, 0x1F6EC, 1},
+		{0x1F6F4, 0x1F6FC, 1},
+		{0x1F7E0, 0x1F7EB, 1},
+		{0x1F7F0, 0x1F7F0, 1},
+		{0x1F90C, 0x1F93A, 1},
+		{0x1F93C, 0x1F945, 1},
+		{0x1F947, 0x1F9FF, 1},
+		{0x1FA70, 0x1FA7C, 1},
+		{0x1FA80, 0x1FA88, 1},
+		{0x1FA90, 0x1FABD, 1},
+		{0x1FABF, 0x1FAC5, 1},
+		{0x1FACE, 0x1FADB, 1},
+		{0x1FAE0, 0x1FAE8, 1},
+		{0x1FAF0, 0x1FAF8, 1},
+		{0x20000, 0x2FFFD, 1},
+		{0x30000, 0x3FFFD, 1},
+	},
+}
+
+// the runes in Extended_Pictographic, the emojis joined by ZWJ are kept
+// in one grapheme cluster
+var extendedPictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00A9, 0x00A9, 1},
+		{0x00AE, 0x00AE, 1},
+		{0x203C, 0x203C, 1},
+		{0x2049, 0x2049, 1},
+		{0x2122, 0x2122, 1},
+		{0x2139, 0x2139, 1},
+		{0x2194, 0x2199, 1},
+		{0x21A9, 0x21AA, 1},
+		{0x231A, 0x231B, 1},
+		{0x2328, 0x2328, 1},
+		{0x2388, 0x2388, 1},
+		{0x23CF, 0x23CF, 1},
+		{0x23E9, 0x23F3, 1},
+		{0x23F8, 0x23FA, 1},
+		{0x24C2, 0x24C2, 1},
+		{0x25AA, 0x25AB, 1},
+		{0x25B6, 0x25B6, 1},
+		{0x25C0, 0x25C0, 1},
+		{0x25FB, 0x25FE, 1},
+		{0x2600, 0x2605, 1},
+		{0x2607, 0x2612, 1},
+		{0x2614, 0x2685, 1},
+		{0x2690, 0x2705, 1},
+		{0x2708, 0x2712, 1},
+		{0x2714, 0x2714, 1},
+		{0x2716, 0x2716, 1},
+		{0x271D, 0x271D, 1},
+		{0x2721, 0x2721, 1},
+		{0x2728, 0x2728, 1},
+		{0x2733, 0x2734, 1},
+		{0x2744, 0x2744, 1},
+		{0x2747, 0x2747, 1},
+		{0x274C, 0x274C, 1},
+		{0x274E, 0x274E, 1},
+		{0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1},
+		{0x2763, 0x2767, 1},
+		{0x2795, 0x2797, 1},
+		{0x27A1, 0x27A1, 1},
+		{0x27B0, 0x27B0, 1},
+		{0x27BF, 0x27BF, 1},
+		{0x2934, 0x2935, 1},
+		{0x2B05, 0x2B07, 1},
+		{0x2B1B, 0x2B1C, 1},
+		{0x2B50, 0x2B50, 1},
+		{0x2B55, 0x2B55, 1},
+		{0x3030, 0x3030, 1},
+		{0x303D, 0x303D, 1},
+		{0x3297, 0x3297, 1},
+		{0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1F000, 0x1F0FF, 1},
+		{0x1F10D, 0x1F10F, 1},
+		{0x1F12F, 0x1F12F, 1},
+		{0x1F16C, 0x1F171, 1},
+		{0x1F17E, 0x1F17F, 1},
+		{0x1F18E, 0x1F18E, 1},
+		{0x1F191, 0x1F19A, 1},
+		{0x1F1AD, 0x1F1E5, 1},
+		{0x1F201, 0x1F20F, 1},
+		{0x1F21A, 0x1F21A, 1},
+		{0x1F22F, 0x1F22F, 1},
+		{0x1F232, 0x1F23A, 1},
+		{0x1F23C, 0x1F23F, 1},
+		{0x1F249, 0x1F3FA, 1},
+		{0x1F400, 0x1F53D, 1},
+		{0x1F546, 0x1F64F, 1},
+		{0x1F680, 0x1F6FF, 1},
+		{0x1F774, 0x1F77F, 1},
+		{0x1F7D5, 0x1F7FF, 1},
+		{0x1F80C, 0x1F80F, 1},
+		{0x1F848, 0x1F84F, 1},
+		{0x1F85A, 0x1F85F, 1},
+		{0x1F888, 0x1F88F, 1},
+		{0x1F8AE, 0x1F8FF, 1},
+		{0x1F90C, 0x1F93A, 1},
+		{0x1F93C, 0x1F945, 1},
+		{0x1F947, 0x1FAFF, 1},
+		{0x1FC00, 0x1FFFD, 1},
+	},
+}
+
+// the Hangul vowels and trailing consonants combine with the leading one
+var hangulJamoExtend = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1160, 0x11FF, 1},
+		{0xD7B0, 0xD7FF, 1},
+	},
+}
+
+// the Grapheme_Cluster_Break property of a rune, see UAX #29
+const (
+	graphemeOther = iota
+	graphemeCR
+	graphemeLF
+	graphemeControl
+	graphemeExtend
+	graphemeZWJ
+	graphemeRegionalIndicator
+	graphemeSpacingMark
+	graphemeL
+	graphemeV
+	graphemeT
+	graphemeLV
+	graphemeLVT
+	graphemePictographic
+)
+
+func graphemeBreakClass(r rune) int {
+	switch {
+	case r < 0x20 || r == 0x7F:
+		if r == '\r' {
+			return graphemeCR
+		} else if r == '\n' {
+			return graphemeLF
+		}
+		return graphemeControl
+	case r < 0xA9:
+		return graphemeOther
+	case r == 0x200D:
+		return graphemeZWJ
+	case r == 0x200C, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F,
+		unicode.In(r, unicode.Mn, unicode.Me):
+		// ZWNJ, the emoji modifiers and the tags are extended too
+		return graphemeExtend
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return graphemeRegionalIndicator
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return graphemeControl
+	case unicode.Is(unicode.Mc, r):
+		return graphemeSpacingMark
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return graphemeL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return graphemeV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return graphemeT
+	case r >= 0xAC00 && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return graphemeLV
+		}
+		return graphemeLVT
+	case unicode.Is(extendedPictographic, r):
+		return graphemePictographic
+	}
+	return graphemeOther
+}
+
+// ClusterLen returns the number of runes in the first extended grapheme
+// cluster of r, which is shown as one character, like an emoji with the
+// skin tone, a flag or a letter with the combining marks.
+func (Runes) ClusterLen(r []rune) int {
+	if len(r) == 0 {
+		return 0
+	}
+	prev := graphemeBreakClass(r[0])
+	// the cluster is an emoji followed by the extends, which can be joined by ZWJ
+	pictographic := prev == graphemePictographic
+	regional := 0
+	if prev == graphemeRegionalIndicator {
+		regional = 1
+	}
+	for i := 1; i < len(r); i++ {
+		cur := graphemeBreakClass(r[i])
+		switch {
+		case prev == graphemeCR && cur == graphemeLF:
+		case prev == graphemeCR, prev == graphemeLF, prev == graphemeControl,
+			cur == graphemeCR, cur == graphemeLF, cur == graphemeControl:
+			return i
+		case prev == graphemeL && (cur == graphemeL || cur == graphemeV || cur == graphemeLV || cur == graphemeLVT):
+		case (prev == graphemeLV || prev == graphemeV) && (cur == graphemeV || cur == graphemeT):
+		case (prev == graphemeLVT || prev == graphemeT) && cur == graphemeT:
+		case cur == graphemeExtend, cur == graphemeZWJ, cur == graphemeSpacingMark:
+		case prev == graphemeZWJ && cur == graphemePictographic && pictographic:
+		case prev == graphemeRegionalIndicator && cur == graphemeRegionalIndicator && regional%2 == 1:
+			regional++
+		default:
+			return i
+		}
+		if cur != graphemeExtend && cur != graphemeZWJ {
+			pictographic = cur == graphemePictographic
+		}
+		prev = cur
+	}
+	return len(r)
+}
+
+// NextCluster returns the index of the cluster after the one at idx
+func (rs Runes) NextCluster(r []rune, idx int) int {
+	if idx >= len(r) {
+		return len(r)
+	}
+	return idx + rs.ClusterLen(r[idx:])
+}
+
+// PrevCluster returns the index of the cluster before idx
+func (rs Runes) PrevCluster(r []rune, idx int) int {
+	if idx > len(r) {
+		idx = len(r)
+	}
+	pos := 0
+	for pos < idx {
+		next := pos + rs.ClusterLen(r[pos:])
+		if next >= idx {
+			break
+		}
+		pos = next
+	}
+	return pos
+}
+
+// ClusterWidth returns the columns of a grapheme cluster in the terminal
+func (Runes) ClusterWidth(c []rune) int {
+	if len(c) == 0 {
+		return 0
+	}
+	if len(c) > 1 {
+		// a flag, or an emoji in the emoji presentation
+		if graphemeBreakClass(c[0]) == graphemeRegionalIndicator {
+			return 2
+		}
+		for _, r := range c[1:] {
+			if r == 0xFE0F {
+				return 2
+			}
+		}
+	}
+	return runes.Width(c[0])
+}
@@ -0,0 +1,145 @@
+package readline
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testConfig fills the functions of the terminal which aren't set, so that
+// the Config works without a tty
+func testConfig(cfg *Config) *Config {
+	if cfg.Stdout == nil {
+		cfg.Stdout = ioutil.Discard
+	}
+	if cfg.Painter == nil {
+		cfg.Painter = &defaultPainter{}
+	}
+	if cfg.FuncIsTerminal == nil {
+		cfg.FuncIsTerminal = func() bool { return cfg.ForceUseInteractive }
+	}
+	if cfg.FuncMakeRaw == nil {
+		cfg.FuncMakeRaw = func() error { return nil }
+	}
+	if cfg.FuncExitRaw == nil {
+		cfg.FuncExitRaw = func() error { return nil }
+	}
+	if cfg.FuncGetWidth == nil {
+		cfg.FuncGetWidth = func() int { return 80 }
+	}
+	if cfg.FuncOnWidthChanged == nil {
+		cfg.FuncOnWidthChanged = func(func()) {}
+	}
+	return cfg
+}
+
+// syncBuffer is the Stdout read by the tests while the ioloop may still
+// write to it
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+// readTestLine reads a line from the keys
+func readTestLine(cfg *Config, keys string) (string, error) {
+	if cfg.Stdin == nil {
+		cfg.Stdin = ioutil.NopCloser(strings.NewReader(keys))
+	}
+	rl, err := NewEx(testConfig(cfg))
+	if err != nil {
+		return "", err
+	}
+	defer rl.Close()
+	return rl.Readline()
+}
+
+// newTestOperation returns the Operation of the line with the cursor at
+// pos, the keys are fed to it by the tests instead of the terminal
+func newTestOperation(cfg *Config, line string, pos int) *Operation {
+	cfg = testConfig(cfg)
+	width := cfg.FuncGetWidth()
+	op := &Operation{
+		cfg:     cfg,
+		t:       &Terminal{cfg: cfg},
+		buf:     NewRuneBuffer(cfg.Stdout, cfg.Prompt, cfg, width),
+		history: newOpHistory(cfg),
+	}
+	op.w = op.buf.w
+	op.opCompleter = newOpCompleter(op.w, op, width)
+	op.opVim = &opVim{cfg: cfg, op: op, registers: newVimRegisters()}
+	// not shown until the first refresh
+	op.buf.buf, op.buf.idx = []rune(line), pos
+	return op
+}
+
+func newTestRuneBuffer(line string, idx int) *RuneBuffer {
+	return newTestOperation(&Config{}, line, idx).buf
+}
+
+// newTestRender returns the interactive RuneBuffer of "> " and what's
+// written to the screen
+func newTestRender(width int) (*RuneBuffer, *bytes.Buffer) {
+	out := bytes.NewBuffer(nil)
+	cfg := testConfig(&Config{
+		Prompt:              "> ",
+		Stdout:              out,
+		ForceUseInteractive: true,
+		FuncGetWidth:        func() int { return width },
+	})
+	return newTestOperation(cfg, "", 0).buf, out
+}
+
+func newTestVim(line string, pos int) *opVim {
+	op := newTestOperation(&Config{VimMode: true}, line, pos)
+	op.opVim.vimMode = VIM_NORMAL
+	return op.opVim
+}
+
+// feed the keys to vim, the runes passed through are inserted like ioloop
+func feedVim(o *opVim, keys string) {
+	rs := []rune(keys)
+	readNext := func() rune {
+		if len(rs) == 0 {
+			return CharEsc
+		}
+		r := rs[0]
+		rs = rs[1:]
+		return r
+	}
+	for len(rs) > 0 {
+		r := o.HandleVim(readNext(), readNext)
+		if IsPrintable(r) {
+			o.op.buf.WriteRune(r)
+		}
+	}
+}
+
+// sedEditor returns the editor which runs the sed script on the file, it's
+// a shell script since `sed -i` isn't portable
+func sedEditor(t *testing.T, script string) string {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not found")
+	}
+	path := filepath.Join(t.TempDir(), "editor")
+	data := "#!/bin/sh\nsed '" + script + "' \"$1\" > \"$1.tmp\" && mv \"$1.tmp\" \"$1\"\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -3,7 +3,9 @@ package readline
 import (
 	"errors"
 	"io"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -18,6 +20,21 @@ func (*InterruptError) Error() string {
 	return "Interrupted"
 }
 
+// ValidateError is returned by Config.FuncValidate to move the cursor to
+// Pos of the line
+type ValidateError struct {
+	Pos int
+	Err error
+}
+
+func (e *ValidateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidateError) Unwrap() error {
+	return e.Err
+}
+
 type Operation struct {
 	m       sync.Mutex
 	cfg     *Config
@@ -27,6 +44,9 @@ type Operation struct {
 	errchan chan error
 	w       io.Writer
 
+	// the error of Config.FuncValidate is shown below the line
+	invalid bool
+
 	history *opHistory
 	*opSearch
 	*opCompleter
@@ -53,7 +73,7 @@ func (w *wrapWriter) Write(b []byte) (int, error) {
 		n   int
 		err error
 	)
-	w.r.buf.Refresh(func() {
+	w.r.buf.Reprint(func() {
 		n, err = w.target.Write(b)
 	})
 
@@ -108,18 +128,35 @@ func (o *Operation) ioloop() {
 	for {
 		keepInSearchMode := false
 		keepInCompleteMode := false
-		r := o.t.ReadRune()
+		// `v` may start the editor in vim mode, the terminal waits after the
+		// key so that the editor gets the keys after it
+		editorMode := o.isVimEditorMode()
+		var key rune
+		if editorMode {
+			key = o.t.ReadRuneAndPause()
+		} else {
+			key = o.t.ReadRune()
+		}
 
-		if o.GetConfig().FuncFilterInputRune != nil {
-			var process bool
-			r, process = o.GetConfig().FuncFilterInputRune(r)
-			if !process {
-				o.t.KickRead()
-				o.buf.Refresh(nil) // to refresh the line
-				continue           // ignore this rune
-			}
+		r, process := o.filterInputRune(key)
+		if !process {
+			continue // ignore this rune
+		}
+		if editorMode && r != 'v' && !isPauseKey(key) {
+			// the editor isn't started, the keys like Enter are kicked
+			// where they're handled
+			o.t.KickRead()
+		}
+
+		// the times to run the command by the numeric argument
+		count, withArgument := 1, false
+		if o.IsArgumentKey(r) {
+			r, count = o.ReadArgument(r)
+			withArgument = true
 		}
 
+		// the line left in the buffer is submitted without validation
+		flush := false
 		if r == 0 { // io.EOF
 			if o.buf.Len() == 0 {
 				o.buf.Clean()
@@ -132,10 +169,20 @@ func (o *Operation) ioloop() {
 				// let's flush them by sending CharEnter.
 				// And we will got io.EOF int next loop.
 				r = CharEnter
+				flush = true
 			}
 		}
+		if o.invalid {
+			// the key hides the error
+			o.invalid = false
+			o.buf.SetBelow(nil, false)
+		}
 		isUpdateHistory := true
 
+		if o.IsInCompleteMenuMode() && o.HandleCompleteMenu(r) {
+			continue
+		}
+
 		if o.IsInCompleteSelectMode() {
 			keepInCompleteMode = o.HandleCompleteSelect(r)
 			if keepInCompleteMode {
@@ -156,185 +203,239 @@ func (o *Operation) ioloop() {
 		}
 
 		if o.IsEnableVimMode() {
-			r = o.HandleVim(r, o.t.ReadRune)
+			r = o.HandleVim(r, o.readVimKey)
 			if r == 0 {
 				continue
 			}
 		}
 
-		switch r {
-		case CharBell:
-			if o.IsSearchMode() {
-				o.ExitSearchMode(true)
-				o.buf.Refresh(nil)
-			}
-			if o.IsInCompleteMode() {
-				o.ExitCompleteMode(true)
-				o.buf.Refresh(nil)
-			}
-		case CharTab:
-			if o.GetConfig().AutoComplete == nil {
-				o.t.Bell()
-				break
-			}
-			if o.OnComplete() {
-				keepInCompleteMode = true
-			} else {
-				o.t.Bell()
-				break
+		if r == CharCtrlX {
+			r = o.handleCtrlX()
+			if r == 0 {
+				continue
 			}
+		}
 
-		case CharBckSearch:
-			if !o.SearchMode(S_DIR_BCK) {
-				o.t.Bell()
-				break
-			}
-			keepInSearchMode = true
-		case CharCtrlU:
-			o.buf.KillFront()
-		case CharFwdSearch:
-			if !o.SearchMode(S_DIR_FWD) {
+		insert := []rune{r}
+		if count > 1 && IsPrintable(r) && r != CharBackspace && !o.IsSearchMode() {
+			// insert the copies at once
+			insert, count = []rune(strings.Repeat(string(r), count)), 1
+		}
+		if count > 1 {
+			// or the line is shown after each of the repeats
+			o.buf.HoldRefresh()
+		}
+		for i := 0; i < count; i++ {
+			switch r {
+			case CharBell:
+				if o.IsSearchMode() {
+					o.ExitSearchMode(true)
+					o.buf.Refresh(nil)
+				}
+				if o.IsInCompleteMode() {
+					o.ExitCompleteMode(true)
+					o.buf.Refresh(nil)
+				}
+			case CharTab:
+				if o.GetConfig().AutoComplete == nil {
+					o.t.Bell()
+					break
+				}
+				if o.OnComplete() {
+					keepInCompleteMode = true
+				} else {
+					o.t.Bell()
+					break
+				}
+
+			case MetaShiftTab:
 				o.t.Bell()
-				break
-			}
-			keepInSearchMode = true
-		case CharKill:
-			o.buf.Kill()
-			keepInCompleteMode = true
-		case MetaForward:
-			o.buf.MoveToNextWord()
-		case CharTranspose:
-			o.buf.Transpose()
-		case MetaBackward:
-			o.buf.MoveToPrevWord()
-		case MetaDelete:
-			o.buf.DeleteWord()
-		case CharLineStart:
-			o.buf.MoveToLineStart()
-		case CharLineEnd:
-			o.buf.MoveToLineEnd()
-		case CharBackspace, CharCtrlH:
-			if o.IsSearchMode() {
-				o.SearchBackspace()
+			case CharBckSearch:
+				if !o.SearchMode(S_DIR_BCK) {
+					o.t.Bell()
+					break
+				}
 				keepInSearchMode = true
-				break
-			}
+			case CharCtrlU:
+				o.buf.KillFront()
+			case CharFwdSearch:
+				if !o.SearchMode(S_DIR_FWD) {
+					o.t.Bell()
+					break
+				}
+				keepInSearchMode = true
+			case CharKill:
+				o.buf.Kill()
+				keepInCompleteMode = true
+			case MetaForward:
+				o.buf.MoveToNextWord()
+			case CharTranspose:
+				o.buf.Transpose()
+			case MetaTranspose:
+				if !o.buf.TransposeWords() {
+					o.t.Bell()
+				}
+			case MetaUpcase:
+				o.buf.UpcaseWord()
+			case MetaDowncase:
+				o.buf.DowncaseWord()
+			case MetaCapitalize:
+				o.buf.CapitalizeWord()
+			case MetaBackward:
+				o.buf.MoveToPrevWord()
+			case MetaDelete:
+				o.buf.DeleteWord()
+			case CharLineStart:
+				o.buf.MoveToLineStart()
+			case CharLineEnd:
+				o.buf.MoveToLineEnd()
+			case CharBackspace, CharCtrlH:
+				if o.IsSearchMode() {
+					o.SearchBackspace()
+					keepInSearchMode = true
+					break
+				}
 
-			if o.buf.Len() == 0 {
-				o.t.Bell()
-				break
-			}
-			o.buf.Backspace()
-			if o.IsInCompleteMode() {
-				o.OnComplete()
-			}
-		case CharCtrlZ:
-			o.buf.Clean()
-			o.t.SleepToResume()
-			o.Refresh()
-		case CharCtrlL:
-			ClearScreen(o.w)
-			o.Refresh()
-		case MetaBackspace, CharCtrlW:
-			o.buf.BackEscapeWord()
-		case CharCtrlY:
-			o.buf.Yank()
-		case CharEnter, CharCtrlJ:
-			if o.IsSearchMode() {
-				o.ExitSearchMode(false)
-			}
-			o.buf.MoveToLineEnd()
-			var data []rune
-			if !o.GetConfig().UniqueEditLine {
-				o.buf.WriteRune('\n')
-				data = o.buf.Reset()
-				data = data[:len(data)-1] // trim \n
-			} else {
+				if o.buf.Len() == 0 {
+					o.t.Bell()
+					break
+				}
+				o.buf.Backspace()
+				if o.IsInCompleteMode() {
+					o.OnComplete()
+				}
+			case CharCtrlZ:
 				o.buf.Clean()
-				data = o.buf.Reset()
-			}
-			o.outchan <- data
-			if !o.GetConfig().DisableAutoSaveHistory {
-				// ignore IO error
-				_ = o.history.New(data)
-			} else {
-				isUpdateHistory = false
-			}
-		case CharBackward:
-			o.buf.MoveBackward()
-		case CharForward:
-			o.buf.MoveForward()
-		case CharPrev:
-			buf := o.history.Prev()
-			if buf != nil {
-				o.buf.Set(buf)
-			} else {
-				o.t.Bell()
-			}
-		case CharNext:
-			buf, ok := o.history.Next()
-			if ok {
-				o.buf.Set(buf)
-			} else {
-				o.t.Bell()
-			}
-		case CharDelete:
-			if o.buf.Len() > 0 || !o.IsNormalMode() {
-				o.t.KickRead()
-				if !o.buf.Delete() {
+				o.t.SleepToResume()
+				o.Refresh()
+			case CharCtrlL:
+				ClearScreen(o.w)
+				o.Refresh()
+			case MetaBackspace, CharCtrlW:
+				o.buf.BackEscapeWord()
+			case CharCtrlY:
+				if !o.buf.Yank() {
 					o.t.Bell()
 				}
-				break
-			}
+			case CharEnter, CharCtrlJ:
+				if o.IsSearchMode() {
+					o.ExitSearchMode(false)
+				}
+				if o.IsInCompleteMode() {
+					// or the grid would be cleared with the error
+					o.ExitCompleteMode(false)
+				}
+				if !flush && !o.validate() {
+					// the terminal waits after Enter, go on editing the line
+					o.t.KickRead()
+					break
+				}
+				if o.IsEnableVimMode() {
+					o.ExitVimMode()
+				}
+				o.buf.MoveToLineEnd()
+				var data []rune
+				if !o.GetConfig().UniqueEditLine {
+					if prompt := o.GetConfig().TransientPrompt; prompt != "" {
+						o.buf.SetTransientPrompt(prompt)
+					}
+					o.buf.WriteRune('\n')
+					data = o.buf.Reset()
+					data = data[:len(data)-1] // trim \n
+				} else {
+					o.buf.Clean()
+					data = o.buf.Reset()
+				}
+				o.outchan <- data
+				if !o.GetConfig().DisableAutoSaveHistory {
+					// ignore IO error
+					_ = o.history.New(data)
+				} else {
+					isUpdateHistory = false
+				}
+			case CharBackward:
+				o.buf.MoveBackward()
+			case CharForward:
+				o.buf.MoveForward()
+			case CharPrev:
+				buf := o.history.Prev()
+				if buf != nil {
+					o.buf.Set(buf)
+				} else {
+					o.t.Bell()
+				}
+			case CharNext:
+				buf, ok := o.history.Next()
+				if ok {
+					o.buf.Set(buf)
+				} else {
+					o.t.Bell()
+				}
+			case CharDelete:
+				if o.buf.Len() > 0 || !o.IsNormalMode() || withArgument {
+					if !withArgument {
+						o.t.KickRead()
+					}
+					if !o.buf.Delete() {
+						o.t.Bell()
+					}
+					break
+				}
 
-			// treat as EOF
-			if !o.GetConfig().UniqueEditLine {
-				o.buf.WriteString(o.GetConfig().EOFPrompt + "\n")
-			}
-			o.buf.Reset()
-			isUpdateHistory = false
-			o.history.Revert()
-			o.errchan <- io.EOF
-			if o.GetConfig().UniqueEditLine {
-				o.buf.Clean()
-			}
-		case CharInterrupt:
-			if o.IsSearchMode() {
-				o.t.KickRead()
-				o.ExitSearchMode(true)
-				break
-			}
-			if o.IsInCompleteMode() {
-				o.t.KickRead()
-				o.ExitCompleteMode(true)
+				// treat as EOF
+				if !o.GetConfig().UniqueEditLine {
+					o.buf.WriteString(o.GetConfig().EOFPrompt + "\n")
+				}
+				o.buf.Reset()
+				isUpdateHistory = false
+				o.history.Revert()
+				o.errchan <- io.EOF
+				if o.GetConfig().UniqueEditLine {
+					o.buf.Clean()
+				}
+			case CharInterrupt:
+				if o.IsSearchMode() {
+					o.t.KickRead()
+					o.ExitSearchMode(true)
+					break
+				}
+				if o.IsInCompleteMode() {
+					o.t.KickRead()
+					o.ExitCompleteMode(true)
+					o.buf.Refresh(nil)
+					break
+				}
+				o.buf.MoveToLineEnd()
 				o.buf.Refresh(nil)
-				break
-			}
-			o.buf.MoveToLineEnd()
-			o.buf.Refresh(nil)
-			hint := o.GetConfig().InterruptPrompt + "\n"
-			if !o.GetConfig().UniqueEditLine {
-				o.buf.WriteString(hint)
-			}
-			remain := o.buf.Reset()
-			if !o.GetConfig().UniqueEditLine {
-				remain = remain[:len(remain)-len([]rune(hint))]
-			}
-			isUpdateHistory = false
-			o.history.Revert()
-			o.errchan <- &InterruptError{remain}
-		default:
-			if o.IsSearchMode() {
-				o.SearchChar(r)
-				keepInSearchMode = true
-				break
-			}
-			o.buf.WriteRune(r)
-			if o.IsInCompleteMode() {
-				o.OnComplete()
-				keepInCompleteMode = true
+				hint := o.GetConfig().InterruptPrompt + "\n"
+				if !o.GetConfig().UniqueEditLine {
+					o.buf.WriteString(hint)
+				}
+				remain := o.buf.Reset()
+				if !o.GetConfig().UniqueEditLine {
+					remain = remain[:len(remain)-len([]rune(hint))]
+				}
+				isUpdateHistory = false
+				o.history.Revert()
+				o.errchan <- &InterruptError{remain}
+			default:
+				if o.IsSearchMode() {
+					o.SearchChar(r)
+					keepInSearchMode = true
+					break
+				}
+				if !o.buf.Insert(insert) {
+					o.t.Bell()
+				}
+				if o.IsInCompleteMode() {
+					o.OnComplete()
+					keepInCompleteMode = true
+				}
 			}
 		}
+		if count > 1 {
+			o.buf.ReleaseRefresh()
+		}
 
 		listener := o.GetConfig().Listener
 		if listener != nil {
@@ -365,6 +466,53 @@ func (o *Operation) ioloop() {
 	}
 }
 
+// readVimKey reads the key after a vim command like `/`, `"` or `d`, the
+// terminal stops reading after the keys ending the line until KickRead.
+func (o *Operation) readVimKey() rune {
+	r := o.t.ReadRune()
+	if isPauseKey(r) {
+		o.t.KickRead()
+	}
+	return r
+}
+
+// filterInputRune passes the key to Config.FuncFilterInputRune, the key is
+// ignored if it's not processed
+func (o *Operation) filterInputRune(r rune) (rune, bool) {
+	filter := o.GetConfig().FuncFilterInputRune
+	if filter == nil {
+		return r, true
+	}
+	r, process := filter(r)
+	if !process {
+		o.t.KickRead()
+		o.buf.Refresh(nil) // to refresh the line
+	}
+	return r, process
+}
+
+// validate checks the line by Config.FuncValidate, the error is shown
+// below the line and the cursor is moved to the Pos of a ValidateError
+func (o *Operation) validate() bool {
+	validate := o.GetConfig().FuncValidate
+	if validate == nil {
+		return true
+	}
+	err := validate(o.buf.Runes())
+	if err == nil {
+		return true
+	}
+	o.invalid = true
+	o.buf.SetBelow([]string{"\033[31m" + err.Error() + "\033[0m"}, false)
+	var verr *ValidateError
+	if errors.As(err, &verr) {
+		o.buf.SetPos(verr.Pos)
+	} else {
+		o.buf.Refresh(nil)
+	}
+	return false
+}
+
 func (o *Operation) Stderr() io.Writer {
 	return &wrapWriter{target: o.GetConfig().Stderr, r: o, t: o.t}
 }
@@ -381,6 +529,8 @@ func (o *Operation) String() (string, error) {
 func (o *Operation) Runes() ([]rune, error) {
 	o.t.EnterRawMode()
 	defer o.t.ExitRawMode()
+	o.beginVimLine()
+	defer o.resetCursorShape()
 
 	listener := o.GetConfig().Listener
 	if listener != nil {
@@ -389,6 +539,11 @@ func (o *Operation) Runes() ([]rune, error) {
 
 	o.buf.Refresh(nil) // print prompt
 	o.t.KickRead()
+	if interval := o.GetConfig().PromptRefreshInterval; interval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go o.refreshPrompt(interval, stop)
+	}
 	select {
 	case r := <-o.outchan:
 		return r, nil
@@ -500,6 +655,24 @@ func (o *Operation) SaveHistory(content string) error {
 	return o.history.New([]rune(content))
 }
 
+// refreshPrompt refreshes the prompts in the interval until stop is closed,
+// they aren't refreshed while the line isn't read, like when it's edited in
+// the editor
+func (o *Operation) refreshPrompt(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if o.t.IsReading() {
+				o.buf.RefreshPrompt()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (o *Operation) Refresh() {
 	if o.t.IsReading() {
 		o.buf.Refresh(nil)
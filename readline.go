@@ -19,6 +19,7 @@ package readline
 
 import (
 	"io"
+	"time"
 )
 
 type Instance struct {
@@ -28,8 +29,40 @@ type Instance struct {
 }
 
 type Config struct {
-	// prompt supports ANSI escape sequence, so we can color some characters even in windows
+	// prompt supports ANSI escape sequence, so we can color some characters even in windows,
+	// it can have multiple lines, and the runes between CharIgnoreStart and CharIgnoreEnd
+	// ("\001" and "\002") don't take space like the \[ and \] of bash's PS1
 	Prompt string
+	// called on each refresh to get the prompt, it's used instead of Prompt
+	// if it's set. It's called with the line locked, so it shouldn't call
+	// the methods of Instance
+	FuncPrompt func() string
+	// called on each refresh to get the prompt shown at the right edge of
+	// the row where the line starts, it's hidden if the line reaches it
+	FuncRightPrompt func() string
+	// refresh the line in the interval while the user is idle, so that
+	// FuncPrompt and FuncRightPrompt can show a clock
+	PromptRefreshInterval time.Duration
+	// called on each change of the line to get the hint shown on the row
+	// below it, like the arguments of the command, "" hides the row
+	FuncHint func(line []rune, pos int) string
+	// shown dim in the empty line, like "type a query, or ? for help", it's
+	// cut to the rest of the row and isn't a part of the line
+	Placeholder string
+	// called with the line when Enter is pressed, the line isn't submitted
+	// if it returns an error, which is shown below the line until the next
+	// key. Return a *ValidateError to move the cursor to the wrong part.
+	FuncValidate func(line []rune) error
+
+	// the maximum count of the runes in the line, 0 for no limit
+	MaxRunes int
+	// reports whether the rune can be typed into the line, like
+	// unicode.IsDigit
+	FuncAllowRune func(r rune) bool
+	// the format of the line, like "####-##-##" or "(###) ###-####": "#"
+	// takes a digit, "@" a letter, "*" any rune, and the others are the
+	// separators put before the next rune typed
+	InputMask string
 
 	// readline will persist historys to file where HistoryFile specified
 	HistoryFile string
@@ -41,6 +74,16 @@ type Config struct {
 
 	// AutoCompleter will called once user press TAB
 	AutoComplete AutoCompleter
+	// how the typed word matches the candidates, CompleteMatchPrefix by default,
+	// CompleteMatchSubstring and CompleteMatchFuzzy rank the candidates by score
+	CompleteMatch int
+	// how to show the candidates, CompleteStyleGrid by default,
+	// CompleteStyleMenu cycles them in place by Tab and Shift-Tab
+	CompleteStyle int
+
+	// the key of universal-argument, which starts a numeric argument of 4
+	// like GNU readline, numeric arguments also start with Meta-digits and Meta--
+	UniversalArgument rune
 
 	// Any key press will pass to Listener
 	// NOTE: Listener will be triggered by (nil, 0, 0) immediately
@@ -50,6 +93,30 @@ type Config struct {
 
 	// If VimMode is true, readline will in vim.insert mode by default
 	VimMode bool
+	// called when the unnamed register of vim mode is changed,
+	// use OSC52Clipboard to copy it to the system clipboard
+	FuncVimClipboard func(text []rune)
+	// the indicators shown before the prompt in each vim mode, like
+	// "[I] " and "[N] ", visual mode uses VimNormalIndicator and replace
+	// mode uses VimInsertIndicator if they are empty
+	VimInsertIndicator  string
+	VimNormalIndicator  string
+	VimVisualIndicator  string
+	VimReplaceIndicator string
+	// change the cursor shape by the vim mode, a beam in insert mode, a block
+	// in normal mode and an underline in replace mode, the shape is restored
+	// when Readline returns
+	VimCursorShape bool
+
+	// the editor to edit the line by Ctrl-X Ctrl-E, $VISUAL or $EDITOR
+	// is used if it's empty
+	Editor string
+	// submit the line after it's edited in the editor, like bash's
+	// edit-and-execute-command
+	EditorSubmit bool
+	// `v` in the normal mode of vim edits the line in the editor like bash,
+	// instead of starting the visual mode
+	VimEditorKey bool
 
 	InterruptPrompt string
 	EOFPrompt       string
@@ -67,6 +134,13 @@ type Config struct {
 	// erase the editing line after user submited it
 	// it use in IM usually.
 	UniqueEditLine bool
+	// the short prompt which the submitted line is shown with in place of
+	// the prompt, to keep the scrollback clean
+	TransientPrompt string
+	// keep the line on one row of the terminal, the row is scrolled to
+	// follow the cursor with "<" and ">" at the edges, like GNU readline's
+	// horizontal-scroll-mode
+	HorizontalScroll bool
 
 	// filter input runes (may be used to disable CtrlZ or for translating some keys to different actions)
 	// -> output = new (translated) rune and true/false if continue with processing this one
@@ -1,8 +1,14 @@
 package readline
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/chzyer/test"
 )
 
 func TestRace(t *testing.T) {
@@ -25,3 +31,91 @@ func TestRace(t *testing.T) {
 
 	rl.Readline()
 }
+
+func TestFuncValidate(t *testing.T) {
+	defer test.New(t)
+
+	validate := func(line []rune) error {
+		if len(line) == 0 {
+			return errors.New("empty")
+		}
+		if i := strings.IndexRune(string(line), '?'); i >= 0 {
+			return &ValidateError{Pos: len([]rune(string(line)[:i])), Err: errors.New("unknown")}
+		}
+		if line[len(line)-1] != ';' {
+			return fmt.Errorf("missing ;")
+		}
+		return nil
+	}
+	ret := []struct {
+		Keys string
+		Line string
+		Out  string
+	}{
+		{"select;\r", "select;", ""},
+		{"select\r;\r", "select;", "\033[31mmissing ;\033[0m"},
+		{"\rok;\r", "ok;", "\033[31mempty\033[0m"},
+		// the cursor is moved to the "?"
+		{"a?b;\r\x04\r", "ab;", "\033[31munknown\033[0m"},
+	}
+	for i, r := range ret {
+		out := &syncBuffer{}
+		line, err := readTestLine(&Config{
+			Prompt:              "> ",
+			Stdout:              out,
+			ForceUseInteractive: true,
+			FuncValidate:        validate,
+		}, r.Keys)
+		test.Nil(err)
+		test.Equal(line, r.Line, fmt.Errorf("%v", i))
+		test.Equal(strings.Contains(out.String(), r.Out), true, fmt.Errorf("%v", i))
+	}
+
+	// vim stays in the normal mode after the line is rejected
+	line, err := readTestLine(&Config{
+		VimMode: true,
+		FuncValidate: func(line []rune) error {
+			if string(line) == "ab" {
+				return errors.New("ab")
+			}
+			return nil
+		},
+	}, "ab\033\rx\r")
+	test.Nil(err)
+	test.Equal(line, "a")
+}
+
+// the error isn't cleared with the candidates shown by Tab
+func TestFuncValidateComplete(t *testing.T) {
+	defer test.New(t)
+
+	stdin, keys := io.Pipe()
+	rl, err := NewEx(testConfig(&Config{
+		Stdin:               stdin,
+		ForceUseInteractive: true,
+		AutoComplete:        NewPrefixCompleter(PcItem("start"), PcItem("stop")),
+		FuncValidate: func(line []rune) error {
+			if !strings.HasSuffix(string(line), ";") {
+				return errors.New("missing ;")
+			}
+			return nil
+		},
+	}))
+	test.Nil(err)
+	defer rl.Close()
+
+	below := make(chan []string, 1)
+	go func() {
+		keys.Write([]byte("st\t\r"))
+		time.Sleep(100 * time.Millisecond)
+		rb := rl.Operation.buf
+		rb.Lock()
+		below <- rb.belowLines()
+		rb.Unlock()
+		keys.Write([]byte(";\r"))
+	}()
+	line, err := rl.Readline()
+	test.Nil(err)
+	test.Equal(line, "st;")
+	test.Equal(<-below, []string{"\033[31mmissing ;\033[0m"})
+}
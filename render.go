@@ -0,0 +1,461 @@
+package readline
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// screenCell is one column on the screen, a wide cluster is kept in its
+// first cell and the next cell is left empty with width 0
+type screenCell struct {
+	text  string
+	style string
+	width int
+}
+
+// screenFrame is what the line looks like on the screen: the prompt and
+// the buffer wrapped by the width of the terminal, followed by the rows
+// below it, like the candidates. The screen is updated by the diff of the
+// frame against the one shown before, so that only the changed cells are
+// written.
+type screenFrame struct {
+	rows [][]screenCell
+	// the cursor
+	row, col int
+}
+
+// frameBuilder lays out the runes into rows of cells
+type frameBuilder struct {
+	width int
+	frame *screenFrame
+	style string
+	// the OSC 8 sequence of the hyperlink
+	link string
+	// the zero width sequences put before the next cell
+	raw string
+	// in CharIgnoreStart and CharIgnoreEnd
+	ignore bool
+	// the cursor is put before the visible rune at cursor, -1 if it's set
+	cursor int
+
+	// the visible runes in [markStart, markEnd) are shown in markStyle
+	markStart, markEnd int
+	markStyle          string
+}
+
+func newFrameBuilder(width int) *frameBuilder {
+	return &frameBuilder{
+		width:  width,
+		frame:  &screenFrame{rows: [][]screenCell{nil}},
+		cursor: -1,
+	}
+}
+
+func (b *frameBuilder) col() int {
+	return len(b.frame.rows[len(b.frame.rows)-1])
+}
+
+func (b *frameBuilder) newRow() {
+	b.frame.rows = append(b.frame.rows, nil)
+}
+
+// fit starts a new row if the rest of the row is too narrow for width
+func (b *frameBuilder) fit(width int) {
+	if b.col()+width > b.width && b.col() > 0 {
+		for b.col() < b.width {
+			b.writeCell(" ", 1)
+		}
+		b.newRow()
+	}
+}
+
+func (b *frameBuilder) writeCell(text string, width int) {
+	b.fit(width)
+	row := len(b.frame.rows) - 1
+	style := b.style + b.link
+	b.frame.rows[row] = append(b.frame.rows[row], screenCell{b.raw + text, style, width})
+	b.raw = ""
+	for i := 1; i < width; i++ {
+		b.frame.rows[row] = append(b.frame.rows[row], screenCell{"", style, 0})
+	}
+}
+
+// addRaw keeps the zero width sequence s with the cell before it, or the
+// next cell at the start of a row
+func (b *frameBuilder) addRaw(s string) {
+	row := b.frame.rows[len(b.frame.rows)-1]
+	for i := len(row) - 1; i >= 0; i-- {
+		if row[i].width > 0 {
+			row[i].text += s
+			return
+		}
+	}
+	b.raw += s
+}
+
+// setCursor puts the cursor at the current position
+func (b *frameBuilder) setCursor() {
+	b.frame.row, b.frame.col = len(b.frame.rows)-1, b.col()
+	if b.frame.col >= b.width {
+		// the next rune starts a new row
+		b.frame.row, b.frame.col = b.frame.row+1, 0
+	}
+	b.cursor = -1
+}
+
+// write lays out rs, the SGR sequences and the hyperlinks are kept in the
+// style of the cells, the other escape sequences and the runes between
+// CharIgnoreStart and CharIgnoreEnd don't take space. If cursor >= 0, the
+// cursor is put before the cursor-th rune which takes space.
+func (b *frameBuilder) write(rs []rune, cursor int) {
+	b.cursor = cursor
+	visible := 0
+	defer func() { b.ignore = false }()
+	for i := 0; i < len(rs); {
+		switch {
+		case rs[i] == '\033':
+			n := escapeLen(rs[i:])
+			b.escape(rs[i : i+n])
+			i += n
+			continue
+		case rs[i] == CharIgnoreStart:
+			b.ignore = true
+			i++
+			continue
+		case rs[i] == CharIgnoreEnd:
+			b.ignore = false
+			i++
+			continue
+		case b.ignore:
+			b.addRaw(string(rs[i]))
+			i++
+			continue
+		}
+		n := runes.ClusterLen(rs[i:])
+		if rs[i] != '\n' && rs[i] != '\t' {
+			// the cursor is put on the wide rune moved to the next row
+			b.fit(runes.ClusterWidth(rs[i : i+n]))
+		}
+		if b.cursor >= 0 && visible >= b.cursor {
+			b.setCursor()
+		}
+		if b.markStyle != "" {
+			if visible == b.markStart {
+				b.setStyle(b.markStyle)
+			} else if visible == b.markEnd {
+				b.setStyle("\033[0m")
+			}
+		}
+		b.writeCluster(rs[i : i+n])
+		visible += n
+		i += n
+	}
+	if b.cursor >= 0 {
+		b.setCursor()
+	}
+}
+
+func (b *frameBuilder) writeCluster(c []rune) {
+	switch c[0] {
+	case '\n':
+		b.newRow()
+		return
+	case '\t':
+		for i := 0; i < TabWidth; i++ {
+			b.writeCell(" ", 1)
+		}
+		return
+	}
+	w := runes.ClusterWidth(c)
+	if w > 0 {
+		b.writeCell(string(c), w)
+		return
+	}
+	// the zero width runes are kept with the cell before them
+	row := b.frame.rows[len(b.frame.rows)-1]
+	if len(row) > 0 && graphemeBreakClass(c[0]) != graphemeControl {
+		for i := len(row) - 1; i >= 0; i-- {
+			if row[i].width > 0 {
+				row[i].text += string(c)
+				break
+			}
+		}
+	}
+}
+
+func (b *frameBuilder) escape(seq []rune) {
+	if isSGR(seq) {
+		b.setStyle(string(seq))
+		return
+	}
+	if target, ok := hyperlink(seq); ok {
+		b.link = ""
+		if target != "" {
+			b.link = string(seq)
+		}
+		return
+	}
+	b.addRaw(string(seq))
+}
+
+func (b *frameBuilder) setStyle(sgr string) {
+	if sgr == "\033[m" || sgr == "\033[0m" {
+		b.style = ""
+		return
+	}
+	b.style += sgr
+}
+
+// wrap starts a new row if the last row is full
+func (b *frameBuilder) wrap() {
+	if b.col() >= b.width {
+		b.newRow()
+	}
+}
+
+// writeLine lays out a line in a new row
+func (b *frameBuilder) writeLine(line string) {
+	b.wrap()
+	b.newRow()
+	b.style, b.link = "", ""
+	b.write([]rune(line), -1)
+}
+
+func (b *frameBuilder) done() *screenFrame {
+	b.wrap()
+	if b.raw != "" {
+		// the sequences at the end are kept with the last cell
+		for i := len(b.frame.rows) - 1; i >= 0 && b.raw != ""; i-- {
+			row := b.frame.rows[i]
+			for j := len(row) - 1; j >= 0; j-- {
+				if row[j].width > 0 {
+					row[j].text += b.raw
+					b.raw = ""
+					break
+				}
+			}
+		}
+	}
+	return b.frame
+}
+
+// hscrollOffset returns the first column of the line shown in a row of
+// avail columns, the line is total columns long and the cursor is at cur.
+// The row is scrolled by half of it when the cursor leaves the row or
+// moves onto the "<" and ">" at the edges.
+func hscrollOffset(off, cur, total, avail int) int {
+	if total <= avail {
+		return 0
+	}
+	lo, hi := off, off+avail-1
+	if off > 0 {
+		lo++
+	}
+	if off+avail < total {
+		hi--
+	}
+	if cur >= lo && cur <= hi && off <= total-avail+1 {
+		return off
+	}
+	off = cur - avail/2
+	// the cursor can be after the last rune
+	if max := total - avail + 1; off > max {
+		off = max
+	}
+	if off < 0 {
+		off = 0
+	}
+	return off
+}
+
+// hscrollRow returns the cells in [off, off+avail) of row, with "<" and
+// ">" at the edges if the row is scrolled or longer
+func hscrollRow(row []screenCell, off, avail int) []screenCell {
+	if off > len(row) {
+		off = len(row)
+	}
+	end := off + avail
+	if end > len(row) {
+		end = len(row)
+	}
+	cells := append([]screenCell(nil), row[off:end]...)
+	n := len(cells)
+	if n == 0 {
+		return cells
+	}
+	blank := screenCell{" ", "", 1}
+	// the wide runes cut by the edges
+	if cells[0].width == 0 {
+		cells[0] = blank
+	}
+	if cells[n-1].width > 1 {
+		cells[n-1] = blank
+	}
+	if off > 0 {
+		cells[0] = screenCell{"<", "", 1}
+		if n > 1 && cells[1].width == 0 {
+			cells[1] = blank
+		}
+	}
+	if end < len(row) {
+		cells[n-1] = screenCell{">", "", 1}
+		if n > 1 && cells[n-2].width > 1 {
+			cells[n-2] = blank
+		}
+	}
+	return cells
+}
+
+// screenWriter writes the sequences which update the screen and keeps
+// track of the cursor
+type screenWriter struct {
+	buf   bytes.Buffer
+	width int
+	// the rows on the screen, which can be moved to without scrolling
+	rows     int
+	row, col int
+	style    string
+}
+
+func newScreenWriter(old *screenFrame, width int) *screenWriter {
+	return &screenWriter{
+		width: width,
+		rows:  len(old.rows),
+		row:   old.row,
+		col:   old.col,
+	}
+}
+
+func (w *screenWriter) csi(n int, cmd byte) {
+	w.buf.WriteString("\033[")
+	if n != 1 {
+		w.buf.WriteString(strconv.Itoa(n))
+	}
+	w.buf.WriteByte(cmd)
+}
+
+func (w *screenWriter) moveTo(row, col int) {
+	if w.col >= w.width {
+		// the cursor is at the end of the row and waits for the next rune,
+		// the terminals don't agree on where the next move starts
+		w.buf.WriteByte('\r')
+		w.col = 0
+	}
+	if row < w.row {
+		w.csi(w.row-row, 'A')
+	} else if row > w.row {
+		down := row - w.row
+		if exists := w.rows - 1 - w.row; exists < down {
+			if exists > 0 {
+				w.csi(exists, 'B')
+			}
+			// scroll the screen for the new rows
+			if w.col != 0 {
+				w.buf.WriteByte('\r')
+			}
+			w.buf.Write(bytes.Repeat([]byte{'\n'}, down-exists))
+			w.col = 0
+			w.rows = row + 1
+		} else {
+			w.csi(down, 'B')
+		}
+	}
+	w.row = row
+
+	switch {
+	case col == w.col:
+	case col == 0:
+		w.buf.WriteByte('\r')
+	case col > w.col:
+		w.csi(col-w.col, 'C')
+	case w.col-col <= 3:
+		w.buf.Write(bytes.Repeat([]byte{'\b'}, w.col-col))
+	default:
+		w.csi(w.col-col, 'D')
+	}
+	w.col = col
+}
+
+func (w *screenWriter) setStyle(style string) {
+	if style == w.style {
+		return
+	}
+	if strings.Contains(w.style, "\033]8;") {
+		w.buf.WriteString("\033]8;;\033\\")
+	}
+	if strings.Contains(w.style, "\033[") {
+		w.buf.WriteString("\033[0m")
+	}
+	w.buf.WriteString(style)
+	w.style = style
+}
+
+func (w *screenWriter) writeCells(cells []screenCell) {
+	for _, c := range cells {
+		if c.width == 0 {
+			continue
+		}
+		w.setStyle(c.style)
+		w.buf.WriteString(c.text)
+		w.col += c.width
+	}
+}
+
+// diff returns the sequences which update the screen from the old frame to f
+func (f *screenFrame) diff(old *screenFrame, width int) []byte {
+	w := newScreenWriter(old, width)
+	for i, row := range f.rows {
+		var prev []screenCell
+		if i < len(old.rows) {
+			prev = old.rows[i]
+		}
+		start := 0
+		for start < len(row) && start < len(prev) && row[start] == prev[start] {
+			start++
+		}
+		if start == len(row) && start == len(prev) {
+			continue
+		}
+		end := len(row)
+		if len(row) == len(prev) {
+			for end > start && row[end-1] == prev[end-1] {
+				end--
+			}
+		}
+		// the wide cluster is written as a whole
+		for start > 0 && start < len(row) && row[start].width == 0 {
+			start--
+		}
+		if start < end {
+			w.moveTo(i, start)
+			w.writeCells(row[start:end])
+		}
+		if len(prev) > len(row) {
+			w.setStyle("")
+			w.moveTo(i, len(row))
+			w.buf.WriteString("\033[K")
+		}
+	}
+	if len(old.rows) > len(f.rows) {
+		w.setStyle("")
+		w.moveTo(len(f.rows), 0)
+		w.buf.WriteString("\033[J")
+		w.rows = len(f.rows)
+	}
+	w.setStyle("")
+	if w.rows < len(f.rows) {
+		w.moveTo(len(f.rows)-1, 0)
+	}
+	w.moveTo(f.row, f.col)
+	return w.buf.Bytes()
+}
+
+// clear returns the sequences which erase the frame, and leave the cursor
+// at the start of it
+func (f *screenFrame) clear(width int) []byte {
+	w := newScreenWriter(f, width)
+	w.moveTo(0, 0)
+	w.buf.WriteString("\033[J")
+	return w.buf.Bytes()
+}
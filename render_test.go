@@ -0,0 +1,369 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chzyer/test"
+)
+
+func TestRenderDiff(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(10)
+	ret := []struct {
+		Op  func()
+		Out string
+	}{
+		{func() { rb.Refresh(nil) }, "> "},
+		{func() { rb.WriteString("ab") }, "ab"},
+		{func() { rb.Refresh(nil) }, ""},
+		{rb.MoveBackward, "\b"},
+		{func() { rb.WriteRune('x') }, "xb\b"},
+		{rb.Backspace, "\bb\033[K\b"},
+		{rb.MoveToLineEnd, "\033[C"},
+		{func() { rb.WriteString("cdefghij") }, "cdefgh\r\nij"},
+		{rb.MoveToLineStart, "\033[A"},
+		{func() { rb.SetBelow([]string{"\033[1mbelow\033[0m"}, true) }, "\033[B\r\n\033[1mbelow\033[0m\033[2A\b\b\b"},
+		{func() { rb.SetBelow(nil, true) }, "\033[2B\r\033[J\033[2A\033[2C"},
+		{rb.Clean, "\r\033[J"},
+		{func() { rb.Refresh(nil) }, "> abcdefgh\r\nij\033[A"},
+	}
+	for i, r := range ret {
+		out.Reset()
+		r.Op()
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+}
+
+func TestHoldRefresh(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(10)
+	ret := []struct {
+		Op  func()
+		Out string
+	}{
+		{func() { rb.WriteString("abcd") }, "> abcd"},
+		{rb.HoldRefresh, ""},
+		{rb.MoveBackward, ""},
+		{rb.MoveBackward, ""},
+		{rb.Backspace, ""},
+		{rb.ReleaseRefresh, "\b\b\bcd\033[K\b\b"},
+		{rb.MoveBackward, "\b"},
+	}
+	for i, r := range ret {
+		out.Reset()
+		r.Op()
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+}
+
+func TestRenderFrame(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Idx  int
+		Rows []string
+		Row  int
+		Col  int
+	}{
+		{"ab你好", 4, []string{"> ab ", "你好"}, 1, 4},
+		{"ab你好", 2, []string{"> ab ", "你好"}, 1, 0},
+		{"abc", 3, []string{"> abc", ""}, 1, 0},
+		{"a\tb", 1, []string{"> a  ", "  b"}, 0, 3},
+		{"a\033[31mb\033[0m", 2, []string{"> ab"}, 0, 4},
+		{"e\u0301x", 2, []string{"> e\u0301x"}, 0, 3},
+	}
+	for i, r := range ret {
+		rb, _ := newTestRender(5)
+		rb.SetWithIdx(r.Idx, []rune(r.Line))
+		frame := rb.frame()
+		test.Equal(frameRows(frame), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(frame.row, r.Row, fmt.Errorf("%v", i))
+		test.Equal(frame.col, r.Col, fmt.Errorf("%v", i))
+	}
+}
+
+func frameRows(frame *screenFrame) []string {
+	var rows []string
+	for _, row := range frame.rows {
+		var line []string
+		for _, c := range row {
+			line = append(line, c.text)
+		}
+		rows = append(rows, strings.Join(line, ""))
+	}
+	return rows
+}
+
+func TestHorizontalScroll(t *testing.T) {
+	defer test.New(t)
+
+	rb, _ := newTestRender(12)
+	rb.cfg.HorizontalScroll = true
+	ret := []struct {
+		Op   func()
+		Rows []string
+		Col  int
+	}{
+		{func() { rb.WriteString("hello") }, []string{"> hello"}, 7},
+		{func() { rb.WriteString(" world foo") }, []string{"> <rld foo"}, 10},
+		{func() { rb.MoveToPrevWord() }, []string{"> <rld foo"}, 7},
+		{rb.MoveToLineStart, []string{"> hello wo>"}, 2},
+		{rb.MoveToNextWord, []string{"> hello wo>"}, 8},
+		{rb.MoveToNextWord, []string{"> <rld foo"}, 7},
+		{func() { rb.Set([]rune("你好世界你好")) }, []string{"> < 界你好"}, 10},
+		{func() { rb.SetPos(0) }, []string{"> 你好世界>"}, 2},
+		{rb.MoveToLineEnd, []string{"> < 界你好"}, 10},
+		{func() { rb.WriteRune('\n') }, []string{"> < 界你好", ""}, 0},
+	}
+	for i, r := range ret {
+		r.Op()
+		frame := rb.frame()
+		test.Equal(frameRows(frame), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(frame.col, r.Col, fmt.Errorf("%v", i))
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	defer test.New(t)
+
+	link := "\033]8;;https://example.com\033\\"
+	ret := []struct {
+		Prompt string
+		Rows   []string
+		Row    int
+		Col    int
+		Out    string
+	}{
+		{"line\n> ", []string{"line", "> ab"}, 1, 4, "line\r\n> ab"},
+		{"\033[1;38;5;208m>\033[0m ", []string{"> ab"}, 0, 4, "\033[1;38;5;208m>\033[0m ab"},
+		{"\001\033[1m\002>\001\033[0m\002 ", []string{"> ab"}, 0, 4, "\033[1m>\033[0m ab"},
+		{"\033]0;title\a> ", []string{"\033]0;title\a> ab"}, 0, 4, "\033]0;title\a> ab"},
+		{link + "g\033]8;;\033\\> ", []string{"g> ab"}, 0, 5, link + "g\033]8;;\033\\> ab"},
+		{"你好 ", []string{"你好 a", "b"}, 1, 1, "你好 a\r\nb"},
+	}
+	for i, r := range ret {
+		rb, out := newTestRender(6)
+		rb.SetPrompt(r.Prompt)
+		rb.Set([]rune("ab"))
+		frame := rb.frame()
+		test.Equal(frameRows(frame), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(frame.row, r.Row, fmt.Errorf("%v", i))
+		test.Equal(frame.col, r.Col, fmt.Errorf("%v", i))
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+}
+
+func TestFuncPrompt(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(12)
+	n := 0
+	rb.cfg.FuncPrompt = func() string {
+		n++
+		return fmt.Sprintf("%d> ", n)
+	}
+	rb.cfg.FuncRightPrompt = func() string { return "\033[2m[rp]\033[0m" }
+	ret := []struct {
+		Op   func()
+		Rows []string
+		Out  string
+	}{
+		{func() { rb.Refresh(nil) }, []string{"1>     [rp]"}, "1>     \033[2m[rp]\033[0m\033[8D"},
+		{func() { rb.WriteString("ab") }, []string{"2> ab  [rp]"}, "\r2> ab"},
+		{func() { rb.WriteString("cd") }, []string{"3> abcd"}, "\r3> abcd\033[K"},
+		{rb.Backspace, []string{"4> abc [rp]"}, "\r4> abc \033[2m[rp]\033[0m\033[5D"},
+	}
+	for i, r := range ret {
+		out.Reset()
+		r.Op()
+		test.Equal(frameRows(rb.screen), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+}
+
+func TestPromptRefreshInterval(t *testing.T) {
+	defer test.New(t)
+
+	stdin, keys := io.Pipe()
+	var n int32
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		keys.Write([]byte("ok\r"))
+	}()
+	line, err := readTestLine(&Config{
+		FuncPrompt: func() string {
+			return fmt.Sprintf("%d> ", atomic.AddInt32(&n, 1))
+		},
+		PromptRefreshInterval: 10 * time.Millisecond,
+		Stdin:                 stdin,
+		ForceUseInteractive:   true,
+	}, "")
+	test.Nil(err)
+	test.Equal(line, "ok")
+	if atomic.LoadInt32(&n) < 4 {
+		t.Fatal("the prompt isn't refreshed", n)
+	}
+}
+
+type countWriter struct {
+	n int
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += len(b)
+	return len(b), nil
+}
+
+// BenchmarkRenderKeystroke reports the bytes written to the terminal for
+// each key typed in a long line
+func BenchmarkRenderKeystroke(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		pos  int
+	}{
+		{"end", 300},
+		{"middle", 150},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			w := &countWriter{}
+			cfg := &Config{Prompt: "> ", Stdout: w, ForceUseInteractive: true}
+			rb := newTestOperation(cfg, strings.Repeat("word ", 60), bench.pos).buf
+			rb.Refresh(nil)
+			w.n = 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if i%2 == 0 {
+					rb.WriteRune('x')
+				} else {
+					rb.Backspace()
+				}
+			}
+			b.ReportMetric(float64(w.n)/float64(b.N), "bytes/key")
+		})
+	}
+}
+
+func TestTransientPrompt(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(20)
+	rb.SetPrompt("~/src\n> ")
+	rb.cfg.FuncRightPrompt = func() string { return "[rp]" }
+	ret := []struct {
+		Op   func()
+		Rows []string
+		Out  string
+	}{
+		{func() { rb.WriteString("ls") }, []string{"~/src", "> ls           [rp]"}, "~/src\r\n> ls           [rp]\033[15D"},
+		{func() { rb.SetTransientPrompt("$ ") }, []string{"$ ls"}, "\033[A\r$ ls\033[K\033[B\r\033[J\033[A\033[4C"},
+		{func() { rb.WriteRune('\n') }, []string{"$ ls", ""}, "\r\n"},
+		{func() { rb.Reset(); rb.Refresh(nil) }, []string{"~/src", ">              [rp]"}, "~/src\r\n>              [rp]\033[17D"},
+	}
+	for i, r := range ret {
+		out.Reset()
+		r.Op()
+		test.Equal(frameRows(rb.screen), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+}
+
+func TestFuncHint(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(20)
+	rb.cfg.FuncHint = func(line []rune, pos int) string {
+		if len(line) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("\033[2m%s %d\033[0m", string(line), pos)
+	}
+	ret := []struct {
+		Op   func()
+		Rows []string
+		Out  string
+	}{
+		{func() { rb.Refresh(nil) }, []string{"> "}, "> "},
+		{func() { rb.WriteString("ls") }, []string{"> ls", "ls 2"}, "ls\r\n\033[2mls 2\033[0m\033[A"},
+		{rb.MoveBackward, []string{"> ls", "ls 1"}, "\033[B\b\033[2m1\033[0m\033[A\b"},
+		{rb.MoveToLineEnd, []string{"> ls", "ls 2"}, "\033[B\033[2m2\033[0m\033[A"},
+		{func() { rb.WriteRune('\n') }, []string{"> ls", ""}, "\033[B\r\033[K"},
+	}
+	for i, r := range ret {
+		out.Reset()
+		r.Op()
+		test.Equal(frameRows(rb.screen), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(12)
+	rb.cfg.Placeholder = "type a query"
+	ret := []struct {
+		Op   func()
+		Rows []string
+		Out  string
+	}{
+		{func() { rb.Refresh(nil) }, []string{"> type a qu"}, "> \033[2mtype a qu\033[0m\033[9D"},
+		{func() { rb.WriteString("ab") }, []string{"> ab"}, "ab\033[K"},
+		{rb.Backspace, []string{"> a"}, "\b\033[K"},
+		{rb.Backspace, []string{"> type a qu"}, "\b\033[2mtype a qu\033[0m\033[9D"},
+	}
+	for i, r := range ret {
+		out.Reset()
+		r.Op()
+		test.Equal(frameRows(rb.screen), r.Rows, fmt.Errorf("%v", i))
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+	}
+	// the placeholder isn't a part of the line
+	test.Equal(len(rb.Runes()), 0)
+
+	// printed without the frames if the width is unknown
+	rb, _ = newTestRender(0)
+	rb.cfg.Placeholder = "type a query"
+	test.Equal(string(rb.output()), ">  \b\033[2mtype a query\033[0m"+strings.Repeat("\b", 12))
+}
+
+func TestRefreshPrompt(t *testing.T) {
+	defer test.New(t)
+
+	rb, out := newTestRender(20)
+	prompt := "a> "
+	rb.cfg.FuncPrompt = func() string { return prompt }
+	rb.Set([]rune("abcd"))
+	rb.SetStyle(1, 3, "7")
+	ret := []struct {
+		Op     func()
+		Out    string
+		Marked bool
+	}{
+		// the line isn't painted again if the prompt isn't changed
+		{func() {}, "", true},
+		// only the prompt is painted, the style is kept
+		{func() { prompt = "b> " }, "\rb\033[6C", true},
+		// the style is dropped by the refresh
+		{func() { rb.Refresh(nil) }, "", false},
+		{func() { prompt = "c> " }, "\rc\033[6C", false},
+	}
+	for i, r := range ret {
+		r.Op()
+		out.Reset()
+		rb.RefreshPrompt()
+		test.Equal(out.String(), r.Out, fmt.Errorf("%v", i))
+		frame := rb.frame()
+		if r.Marked {
+			frame = rb.frameWithMark(1, 3, "\033[7m")
+		}
+		test.Equal(rb.screen, frame, fmt.Errorf("%v", i))
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 type runeBufferBck struct {
@@ -18,10 +20,18 @@ type RuneBuffer struct {
 	buf    []rune
 	idx    int
 	prompt []rune
-	w      io.Writer
+	// shown before the prompt, like the vim mode indicator
+	promptPrefix []rune
+	// shown at the right edge of the row
+	rightPrompt []rune
+	// shown in place of the prompts after the line is submitted
+	transient []rune
+	w         io.Writer
 
 	hadClean    bool
 	interactive bool
+	// the changes aren't shown until ReleaseRefresh
+	refreshHeld bool
 	cfg         *Config
 
 	width int
@@ -32,6 +42,20 @@ type RuneBuffer struct {
 
 	lastKill []rune
 
+	// the lines shown below the input, like the candidates
+	below []string
+	// from Config.FuncHint, shown above the lines below
+	hint string
+	// the frame on the screen, which is nil after clean
+	screen *screenFrame
+	// the width is changed after the screen is shown
+	screenStale bool
+	// the first column of the line shown in the horizontal scroll mode
+	hscroll int
+	// the style set by SetStyle, which is kept until the next refresh
+	markStart, markEnd int
+	markStyle          string
+
 	sync.Mutex
 }
 
@@ -42,6 +66,12 @@ func (r *RuneBuffer) pushKill(text []rune) {
 func (r *RuneBuffer) OnWidthChange(newWidth int) {
 	r.Lock()
 	r.width = newWidth
+	if r.screen != nil && r.diffRender() {
+		// most terminals rewrap the line by the new width, the frame is
+		// erased and printed again on the next refresh
+		r.screen = r.markedFrame()
+		r.screenStale = true
+	}
 	r.Unlock()
 }
 
@@ -99,7 +129,29 @@ func (r *RuneBuffer) PromptLen() int {
 }
 
 func (r *RuneBuffer) promptLen() int {
-	return runes.WidthAll(runes.ColorFilter(r.prompt))
+	_, col := r.promptSize()
+	return col
+}
+
+// promptSize returns the rows of the prompt above the line, and the column
+// where the line starts, a long prompt is wrapped by the width
+func (r *RuneBuffer) promptSize() (rows, col int) {
+	width := r.width
+	if width <= 0 {
+		width = math.MaxInt32
+	}
+	b := newFrameBuilder(width)
+	b.write(r.prompts(), -1)
+	b.wrap()
+	return len(b.frame.rows) - 1, b.col()
+}
+
+// prompts returns the prompt prefix and the prompt shown before the line
+func (r *RuneBuffer) prompts() []rune {
+	if r.transient != nil {
+		return r.transient
+	}
+	return append(append([]rune(nil), r.promptPrefix...), r.prompt...)
 }
 
 func (r *RuneBuffer) RuneSlice(i int) []rune {
@@ -147,10 +199,7 @@ func (r *RuneBuffer) MoveToLineStart() {
 
 func (r *RuneBuffer) MoveBackward() {
 	r.Refresh(func() {
-		if r.idx == 0 {
-			return
-		}
-		r.idx--
+		r.idx = runes.PrevCluster(r.buf, r.idx)
 	})
 }
 
@@ -170,13 +219,93 @@ func (r *RuneBuffer) WriteRunes(s []rune) {
 	})
 }
 
+// Insert writes s at the cursor like WriteRunes, the runes which break
+// Config.MaxRunes, FuncAllowRune or InputMask are dropped, and it returns
+// false if any of them is dropped.
+func (r *RuneBuffer) Insert(s []rune) (success bool) {
+	r.Refresh(func() {
+		r.buf, r.idx, success = r.constrain(r.buf, r.idx, s)
+	})
+	return
+}
+
+// replace sets the line to buf with s in place of [start, end), s is
+// inserted like Insert
+func (r *RuneBuffer) replace(buf []rune, start, end int, s []rune) (success bool) {
+	r.Refresh(func() {
+		rest := append(runes.Copy(buf[:start]), buf[end:]...)
+		r.buf, r.idx, success = r.constrain(rest, start, s)
+	})
+	return
+}
+
 func (r *RuneBuffer) MoveForward() {
 	r.Refresh(func() {
-		if r.idx == len(r.buf) {
+		r.idx = runes.NextCluster(r.buf, r.idx)
+	})
+}
+
+// SetPos moves the cursor to pos
+func (r *RuneBuffer) SetPos(pos int) {
+	r.Refresh(func() {
+		if pos < 0 {
+			pos = 0
+		} else if pos > len(r.buf) {
+			pos = len(r.buf)
+		}
+		r.idx = pos
+	})
+}
+
+// Cut removes and returns the runes in [start, end), and moves
+// the cursor to start.
+func (r *RuneBuffer) Cut(start, end int) (ret []rune) {
+	r.Refresh(func() {
+		if start < 0 || end > len(r.buf) || start > end {
 			return
 		}
-		r.idx++
+		if start == end {
+			// like the inside of "()", the text is inserted there
+			r.idx = start
+			return
+		}
+		ret = r.remove(start, end)
+	})
+	return
+}
+
+// remove removes the runes in [start, end) and moves the cursor to start,
+// the rest is reflowed into the slots of Config.InputMask. It returns the
+// runes removed, or nil if the line is kept since the rest breaks the mask.
+func (r *RuneBuffer) remove(start, end int) []rune {
+	text := runes.Copy(r.buf[start:end])
+	buf := make([]rune, 0, len(r.buf)-len(text))
+	buf = append(buf, r.buf[:start]...)
+	buf = append(buf, r.buf[end:]...)
+	buf, idx, ok := r.reflowMask(buf, start)
+	if !ok {
+		return nil
+	}
+	r.buf, r.idx = buf, idx
+	return text
+}
+
+// MapRunes replaces each rune in [start, end) by f, the line is kept if
+// the result breaks Config.MaxRunes, FuncAllowRune or InputMask.
+func (r *RuneBuffer) MapRunes(start, end int, f func(rune) rune) (success bool) {
+	r.Refresh(func() {
+		if start < 0 || end > len(r.buf) {
+			return
+		}
+		buf := runes.Copy(r.buf)
+		for i := start; i < end; i++ {
+			buf[i] = f(buf[i])
+		}
+		if success = r.allowLine(buf); success {
+			r.buf = buf
+		}
 	})
+	return
 }
 
 func (r *RuneBuffer) IsCursorInEnd() bool {
@@ -204,8 +333,11 @@ func (r *RuneBuffer) Delete() (success bool) {
 		if r.idx == len(r.buf) {
 			return
 		}
-		r.pushKill(r.buf[r.idx : r.idx+1])
-		r.buf = append(r.buf[:r.idx], r.buf[r.idx+1:]...)
+		text := r.remove(r.idx, runes.NextCluster(r.buf, r.idx))
+		if text == nil {
+			return
+		}
+		r.pushKill(text)
 		success = true
 	})
 	return
@@ -221,9 +353,10 @@ func (r *RuneBuffer) DeleteWord() {
 	}
 	for i := init + 1; i < len(r.buf); i++ {
 		if !IsWordBreak(r.buf[i]) && IsWordBreak(r.buf[i-1]) {
-			r.pushKill(r.buf[r.idx : i-1])
 			r.Refresh(func() {
-				r.buf = append(r.buf[:r.idx], r.buf[i-1:]...)
+				if text := r.remove(r.idx, i-1); text != nil {
+					r.pushKill(text)
+				}
 			})
 			return
 		}
@@ -256,41 +389,127 @@ func (r *RuneBuffer) KillFront() {
 			return
 		}
 
-		length := len(r.buf) - r.idx
-		r.pushKill(r.buf[:r.idx])
-		copy(r.buf[:length], r.buf[r.idx:])
-		r.idx = 0
-		r.buf = r.buf[:length]
+		if text := r.remove(0, r.idx); text != nil {
+			r.pushKill(text)
+		}
 	})
 }
 
 func (r *RuneBuffer) Kill() {
 	r.Refresh(func() {
-		r.pushKill(r.buf[r.idx:])
-		r.buf = r.buf[:r.idx]
+		if text := r.remove(r.idx, len(r.buf)); text != nil {
+			r.pushKill(text)
+		}
 	})
 }
 
 func (r *RuneBuffer) Transpose() {
 	r.Refresh(func() {
-		if len(r.buf) == 1 {
-			r.idx++
-		}
-
-		if len(r.buf) < 2 {
+		if runes.NextCluster(r.buf, 0) == len(r.buf) {
+			r.idx = len(r.buf)
 			return
 		}
 
 		if r.idx == 0 {
-			r.idx = 1
+			r.idx = runes.NextCluster(r.buf, 0)
 		} else if r.idx >= len(r.buf) {
-			r.idx = len(r.buf) - 1
+			r.idx = runes.PrevCluster(r.buf, len(r.buf))
+		}
+		// swap the clusters before and after the cursor
+		start := runes.PrevCluster(r.buf, r.idx)
+		end := runes.NextCluster(r.buf, r.idx)
+		buf := runes.Copy(r.buf)
+		copy(buf[start:], r.buf[r.idx:end])
+		copy(buf[start+end-r.idx:], r.buf[start:r.idx])
+		r.setLine(buf, end)
+	})
+}
+
+// TransposeWords drags the word before the cursor past the word after it,
+// and moves the cursor after them. The last two words are transposed at
+// the end of the line.
+func (r *RuneBuffer) TransposeWords() (success bool) {
+	r.Refresh(func() {
+		w2End := r.wordEnd(r.idx)
+		w2Start := r.wordStart(w2End)
+		w1Start := r.wordStart(w2Start)
+		w1End := r.wordEnd(w1Start)
+		if w1Start == w2Start || w2Start < w1End {
+			return
+		}
+		buf := make([]rune, 0, len(r.buf))
+		buf = append(buf, r.buf[:w1Start]...)
+		buf = append(buf, r.buf[w2Start:w2End]...)
+		buf = append(buf, r.buf[w1End:w2Start]...)
+		buf = append(buf, r.buf[w1Start:w1End]...)
+		buf = append(buf, r.buf[w2End:]...)
+		success = r.setLine(buf, w2End)
+	})
+	return
+}
+
+// UpcaseWord uppercases from the cursor to the end of the word,
+// and moves the cursor after it.
+func (r *RuneBuffer) UpcaseWord() {
+	r.caseWord(unicode.ToUpper, false)
+}
+
+// DowncaseWord lowercases from the cursor to the end of the word,
+// and moves the cursor after it.
+func (r *RuneBuffer) DowncaseWord() {
+	r.caseWord(unicode.ToLower, false)
+}
+
+// CapitalizeWord turns the first letter from the cursor into title case
+// and the rest of the word into lower case, and moves the cursor after it.
+func (r *RuneBuffer) CapitalizeWord() {
+	r.caseWord(unicode.ToLower, true)
+}
+
+func (r *RuneBuffer) caseWord(f func(rune) rune, title bool) {
+	r.Refresh(func() {
+		end := r.wordEnd(r.idx)
+		buf := runes.Copy(r.buf)
+		for i := r.idx; i < end; i++ {
+			if title && isWordRune(buf[i]) {
+				buf[i] = unicode.ToTitle(buf[i])
+				title = false
+				continue
+			}
+			buf[i] = f(buf[i])
 		}
-		r.buf[r.idx], r.buf[r.idx-1] = r.buf[r.idx-1], r.buf[r.idx]
-		r.idx++
+		r.setLine(buf, end)
 	})
 }
 
+// the end of the word at or after idx
+func (r *RuneBuffer) wordEnd(idx int) int {
+	for idx < len(r.buf) && !isWordRune(r.buf[idx]) {
+		idx++
+	}
+	for idx < len(r.buf) && isWordRune(r.buf[idx]) {
+		idx++
+	}
+	return idx
+}
+
+// the start of the word before idx
+func (r *RuneBuffer) wordStart(idx int) int {
+	for idx > 0 && !isWordRune(r.buf[idx-1]) {
+		idx--
+	}
+	for idx > 0 && isWordRune(r.buf[idx-1]) {
+		idx--
+	}
+	return idx
+}
+
+// the words of the case and transpose commands consist of the letters and
+// digits in any language
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
 func (r *RuneBuffer) MoveToNextWord() {
 	r.Refresh(func() {
 		for i := r.idx + 1; i < len(r.buf); i++ {
@@ -333,9 +552,9 @@ func (r *RuneBuffer) BackEscapeWord() {
 		}
 		for i := r.idx - 1; i > 0; i-- {
 			if !IsWordBreak(r.buf[i]) && IsWordBreak(r.buf[i-1]) {
-				r.pushKill(r.buf[i:r.idx])
-				r.buf = append(r.buf[:i], r.buf[r.idx:]...)
-				r.idx = i
+				if text := r.remove(i, r.idx); text != nil {
+					r.pushKill(text)
+				}
 				return
 			}
 		}
@@ -345,18 +564,11 @@ func (r *RuneBuffer) BackEscapeWord() {
 	})
 }
 
-func (r *RuneBuffer) Yank() {
+func (r *RuneBuffer) Yank() (success bool) {
 	if len(r.lastKill) == 0 {
-		return
+		return false
 	}
-	r.Refresh(func() {
-		buf := make([]rune, 0, len(r.buf)+len(r.lastKill))
-		buf = append(buf, r.buf[:r.idx]...)
-		buf = append(buf, r.lastKill...)
-		buf = append(buf, r.buf[r.idx:]...)
-		r.buf = buf
-		r.idx += len(r.lastKill)
-	})
+	return r.Insert(r.lastKill)
 }
 
 func (r *RuneBuffer) Backspace() {
@@ -365,8 +577,7 @@ func (r *RuneBuffer) Backspace() {
 			return
 		}
 
-		r.idx--
-		r.buf = append(r.buf[:r.idx], r.buf[r.idx+1:]...)
+		r.remove(runes.PrevCluster(r.buf, r.idx), r.idx)
 	})
 }
 
@@ -450,6 +661,62 @@ func (r *RuneBuffer) CursorLineCount() int {
 func (r *RuneBuffer) Refresh(f func()) {
 	r.Lock()
 	defer r.Unlock()
+	r.markStyle = ""
+
+	if !r.interactive || r.refreshHeld {
+		if r.refreshHeld && !r.diffRender() {
+			// erase the line before it's changed, it can't be erased
+			// once the cursor isn't known
+			r.clean()
+		}
+		if f != nil {
+			f()
+		}
+		return
+	}
+
+	if r.diffRender() {
+		if f != nil {
+			f()
+		}
+		r.updatePrompt()
+		r.updateHint()
+		r.render()
+		return
+	}
+
+	r.clean()
+	if f != nil {
+		f()
+	}
+	r.updatePrompt()
+	r.updateHint()
+	r.print()
+	r.printBelow()
+}
+
+// HoldRefresh stops showing the changes, so that the commands repeated
+// by the numeric argument are shown once by ReleaseRefresh.
+func (r *RuneBuffer) HoldRefresh() {
+	r.Lock()
+	r.refreshHeld = true
+	r.Unlock()
+}
+
+// ReleaseRefresh shows the changes since HoldRefresh.
+func (r *RuneBuffer) ReleaseRefresh() {
+	r.Lock()
+	r.refreshHeld = false
+	r.Unlock()
+	r.Refresh(nil)
+}
+
+// Reprint erases the line, runs f which can write to the screen, and
+// prints the line again below the output of f.
+func (r *RuneBuffer) Reprint(f func()) {
+	r.Lock()
+	defer r.Unlock()
+	r.markStyle = ""
 
 	if !r.interactive {
 		if f != nil {
@@ -462,7 +729,272 @@ func (r *RuneBuffer) Refresh(f func()) {
 	if f != nil {
 		f()
 	}
+	r.updatePrompt()
+	r.updateHint()
+	if r.diffRender() {
+		r.render()
+		return
+	}
 	r.print()
+	r.printBelow()
+}
+
+// RefreshPrompt shows the prompts again if Config.FuncPrompt or
+// Config.FuncRightPrompt returns the different ones, the style set by
+// SetStyle is kept.
+func (r *RuneBuffer) RefreshPrompt() {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.interactive {
+		return
+	}
+	prompt, rightPrompt := r.prompt, r.rightPrompt
+	r.updatePrompt()
+	if runes.Equal(prompt, r.prompt) && runes.Equal(rightPrompt, r.rightPrompt) {
+		return
+	}
+	if r.diffRender() {
+		r.render()
+		return
+	}
+	r.clean()
+	r.print()
+	r.printBelow()
+	if r.markStyle != "" {
+		r.printStyle(r.markStart, r.markEnd, r.markStyle)
+	}
+}
+
+// updatePrompt gets the prompts from Config.FuncPrompt and
+// Config.FuncRightPrompt
+func (r *RuneBuffer) updatePrompt() {
+	if r.transient != nil {
+		r.rightPrompt = nil
+		return
+	}
+	if r.cfg.FuncPrompt != nil {
+		r.prompt = []rune(r.cfg.FuncPrompt())
+	}
+	r.rightPrompt = nil
+	if r.cfg.FuncRightPrompt != nil {
+		r.rightPrompt = []rune(r.cfg.FuncRightPrompt())
+	}
+}
+
+// updateHint gets the hint from Config.FuncHint, which is hidden after the
+// line is submitted
+func (r *RuneBuffer) updateHint() {
+	r.hint = ""
+	if r.cfg.FuncHint == nil || r.transient != nil || r.submitted() {
+		return
+	}
+	r.hint = r.cfg.FuncHint(runes.Copy(r.buf), r.idx)
+}
+
+// submitted reports whether the line is submitted by Enter, which writes
+// "\n" at the end of it
+func (r *RuneBuffer) submitted() bool {
+	return len(r.buf) > 0 && r.buf[len(r.buf)-1] == '\n' && r.idx == len(r.buf)
+}
+
+// placeholder returns Config.Placeholder cut to avail columns, if it's
+// shown in the empty line
+func (r *RuneBuffer) placeholder(avail int) []rune {
+	if len(r.buf) > 0 || r.transient != nil || r.cfg.Placeholder == "" {
+		return nil
+	}
+	rs := runes.ColorFilter([]rune(r.cfg.Placeholder))
+	width := 0
+	for i := 0; i < len(rs); {
+		n := runes.ClusterLen(rs[i:])
+		if width += runes.ClusterWidth(rs[i : i+n]); width > avail {
+			return rs[:i]
+		}
+		i += n
+	}
+	return rs
+}
+
+// belowLines returns the hint and the lines below the input
+func (r *RuneBuffer) belowLines() []string {
+	if r.hint == "" {
+		return r.below
+	}
+	return append([]string{r.hint}, r.below...)
+}
+
+// diffRender reports whether the screen is updated by the diff of the
+// frames, or by erasing and printing the whole line, which is used if the
+// width is unknown or on windows, where the cursor wraps at the end of
+// the row.
+func (r *RuneBuffer) diffRender() bool {
+	return r.width > 0 && (!isWindows || r.cfg.HorizontalScroll)
+}
+
+// frame lays out the prompt, the buffer and the lines below
+func (r *RuneBuffer) frame() *screenFrame {
+	return r.frameWithMark(0, 0, "")
+}
+
+func (r *RuneBuffer) frameWithMark(start, end int, style string) *screenFrame {
+	b := newFrameBuilder(r.width)
+	b.write(r.prompts(), -1)
+	// the row and the column where the line starts
+	row, col := len(b.frame.rows)-1, b.col()
+	if col >= r.width {
+		row, col = row+1, 0
+	}
+	if r.cfg.HorizontalScroll {
+		r.writeScrolled(b, start, end, style)
+	} else {
+		b.markStart, b.markEnd, b.markStyle = start, end, style
+		b.write(r.display(), r.idx)
+		b.markStyle = ""
+	}
+	if ph := r.placeholder(r.width - 1 - col); len(ph) > 0 {
+		b.write([]rune("\033[2m"+string(ph)+"\033[0m"), -1)
+	}
+	r.writeRightPrompt(b, row)
+	for _, line := range r.belowLines() {
+		b.writeLine(line)
+	}
+	return b.done()
+}
+
+// writeRightPrompt puts the right prompt at the end of the row if there's
+// room for it, the last column is left empty like the line
+func (r *RuneBuffer) writeRightPrompt(b *frameBuilder, row int) {
+	if len(r.rightPrompt) == 0 || row >= len(b.frame.rows) {
+		return
+	}
+	lb := newFrameBuilder(math.MaxInt32)
+	lb.write(r.rightPrompt, -1)
+	cells := lb.done().rows[0]
+	start := r.width - 1 - len(cells)
+	// keep a space after the line
+	if len(b.frame.rows[row])+1 > start {
+		return
+	}
+	for len(b.frame.rows[row]) < start {
+		b.frame.rows[row] = append(b.frame.rows[row], screenCell{" ", "", 1})
+	}
+	b.frame.rows[row] = append(b.frame.rows[row], cells...)
+}
+
+// display returns the buffer as it's shown, painted or masked
+func (r *RuneBuffer) display() []rune {
+	if r.cfg.EnableMask && len(r.buf) > 0 {
+		mask := []rune(strings.Repeat(string(r.cfg.MaskRune), len(r.buf)))
+		if r.buf[len(r.buf)-1] == '\n' {
+			mask[len(mask)-1] = '\n'
+		}
+		return mask
+	}
+	return r.cfg.Painter.Paint(r.buf, r.idx)
+}
+
+// writeScrolled lays out the buffer in the rest of the row after the
+// prompt, the row is scrolled to show the cursor
+func (r *RuneBuffer) writeScrolled(b *frameBuilder, start, end int, style string) {
+	line, idx := r.display(), r.idx
+	// the line submitted by Enter ends with "\n", which moves to the next row
+	submit := len(r.buf) > 0 && r.buf[len(r.buf)-1] == '\n' &&
+		len(line) > 0 && line[len(line)-1] == '\n'
+	if submit {
+		line = line[:len(line)-1]
+		if idx >= len(r.buf) {
+			idx = len(r.buf) - 1
+		}
+	}
+
+	lb := newFrameBuilder(math.MaxInt32)
+	lb.style = b.style
+	lb.markStart, lb.markEnd, lb.markStyle = start, end, style
+	lb.write(line, idx)
+	var row []screenCell
+	cur := 0
+	for i, cells := range lb.frame.rows {
+		if i == lb.frame.row {
+			cur = len(row) + lb.frame.col
+		}
+		row = append(row, cells...)
+	}
+
+	col := b.col()
+	avail := r.width - 1 - col
+	if avail < 1 {
+		avail = 1
+	}
+	r.hscroll = hscrollOffset(r.hscroll, cur, len(row), avail)
+	last := len(b.frame.rows) - 1
+	b.frame.rows[last] = append(b.frame.rows[last], hscrollRow(row, r.hscroll, avail)...)
+	b.frame.row, b.frame.col = last, col+cur-r.hscroll
+	if submit && r.idx == len(r.buf) {
+		b.newRow()
+		b.frame.row, b.frame.col = last+1, 0
+	}
+}
+
+// render updates the screen to the current frame
+func (r *RuneBuffer) render() {
+	r.renderFrame(r.markedFrame())
+}
+
+// markedFrame is the frame with the style set by SetStyle
+func (r *RuneBuffer) markedFrame() *screenFrame {
+	if r.markStyle == "" {
+		return r.frame()
+	}
+	return r.frameWithMark(r.markStart, r.markEnd, "\033["+r.markStyle+"m")
+}
+
+func (r *RuneBuffer) renderFrame(frame *screenFrame) {
+	if r.screenStale {
+		r.clean()
+		r.screenStale = false
+	}
+	old := r.screen
+	if old == nil {
+		old = newFrameBuilder(r.width).done()
+	}
+	r.w.Write(frame.diff(old, r.width))
+	r.screen = frame
+	r.hadClean = false
+}
+
+// SetBelow sets the lines shown below the input, and refreshes the line
+// if needed.
+func (r *RuneBuffer) SetBelow(lines []string, refresh bool) {
+	if !refresh {
+		r.Lock()
+		r.below = lines
+		r.Unlock()
+		return
+	}
+	r.Refresh(func() {
+		r.below = lines
+	})
+}
+
+// printBelow prints the lines below the input and moves the cursor back
+func (r *RuneBuffer) printBelow() {
+	below := r.belowLines()
+	if len(below) == 0 || r.width == 0 {
+		return
+	}
+	lineCnt := LineCount(r.width, runes.WidthAll(r.buf)+r.promptLen()) - r.idxLine(r.width)
+	x := (runes.WidthAll(r.buf[:r.idx]) + r.promptLen()) % r.width
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(bytes.Repeat([]byte("\n"), lineCnt))
+	buf.WriteString("\033[J")
+	buf.WriteString(strings.Join(below, "\n"))
+	buf.WriteString("\r\033[" + strconv.Itoa(lineCnt-1+len(below)) + "A")
+	if x > 0 {
+		buf.WriteString("\033[" + strconv.Itoa(x) + "C")
+	}
+	r.w.Write(buf.Bytes())
 }
 
 func (r *RuneBuffer) SetOffset(offset string) {
@@ -478,7 +1010,7 @@ func (r *RuneBuffer) print() {
 
 func (r *RuneBuffer) output() []byte {
 	buf := bytes.NewBuffer(nil)
-	buf.WriteString(string(r.prompt))
+	buf.WriteString(string(r.prompts()))
 	if r.cfg.EnableMask && len(r.buf) > 0 {
 		buf.Write([]byte(strings.Repeat(string(r.cfg.MaskRune), len(r.buf)-1)))
 		if r.buf[len(r.buf)-1] == '\n' {
@@ -502,6 +1034,14 @@ func (r *RuneBuffer) output() []byte {
 			buf.Write([]byte(" \b"))
 		}
 	}
+	avail := math.MaxInt32
+	if r.width > 0 {
+		avail = r.width - 1 - r.promptLen()
+	}
+	if ph := r.placeholder(avail); len(ph) > 0 {
+		buf.WriteString("\033[2m" + string(ph) + "\033[0m")
+		buf.Write(bytes.Repeat([]byte{'\b'}, runes.WidthAll(ph)))
+	}
 	// cursor position
 	if len(r.buf) > r.idx {
 		buf.Write(r.getBackspaceSequence())
@@ -526,8 +1066,8 @@ func (r *RuneBuffer) getBackspaceSequence() []byte {
 		sep[i] = true
 	}
 	var buf []byte
-	for i := len(r.buf); i > r.idx; i-- {
-		// move input to the left of one
+	for i := runes.WidthAll(r.buf); i > runes.WidthAll(r.buf[:r.idx]); i-- {
+		// move input to the left of one column
 		buf = append(buf, '\b')
 		if sep[i] {
 			// up one line, go to the start of the line and move cursor right to the end (r.width)
@@ -539,10 +1079,16 @@ func (r *RuneBuffer) getBackspaceSequence() []byte {
 
 }
 
+// Reset empties the buffer, the line on the screen is left as it is and
+// the next refresh prints a new one.
 func (r *RuneBuffer) Reset() []rune {
 	ret := runes.Copy(r.buf)
 	r.buf = r.buf[:0]
 	r.idx = 0
+	r.screen = nil
+	r.screenStale = false
+	r.hscroll = 0
+	r.transient = nil
 	return ret
 }
 
@@ -557,7 +1103,18 @@ func (r *RuneBuffer) SetStyle(start, end int, style string) {
 	if end < start {
 		panic("end < start")
 	}
+	r.Lock()
+	r.markStart, r.markEnd, r.markStyle = start, end, style
+	if r.interactive && r.diffRender() {
+		r.render()
+		r.Unlock()
+		return
+	}
+	r.Unlock()
+	r.printStyle(start, end, style)
+}
 
+func (r *RuneBuffer) printStyle(start, end int, style string) {
 	// goto start
 	move := start - r.idx
 	if move > 0 {
@@ -568,7 +1125,13 @@ func (r *RuneBuffer) SetStyle(start, end int, style string) {
 	r.w.Write([]byte("\033[" + style + "m"))
 	r.w.Write([]byte(string(r.buf[start:end])))
 	r.w.Write([]byte("\033[0m"))
-	// TODO: move back
+
+	// move back
+	if end > r.idx {
+		r.w.Write(bytes.Repeat([]byte("\b"), runes.WidthAll(r.buf[r.idx:end])))
+	} else {
+		r.w.Write([]byte(string(r.buf[end:r.idx])))
+	}
 }
 
 func (r *RuneBuffer) SetWithIdx(idx int, buf []rune) {
@@ -588,6 +1151,37 @@ func (r *RuneBuffer) SetPrompt(prompt string) {
 	r.Unlock()
 }
 
+// SetTransientPrompt shows the line with prompt in place of the prompts
+// until Reset, the right prompt and the lines below are hidden.
+func (r *RuneBuffer) SetTransientPrompt(prompt string) {
+	r.Refresh(func() {
+		r.transient = []rune(prompt)
+		r.below = nil
+	})
+}
+
+func (r *RuneBuffer) PromptPrefix() string {
+	r.Lock()
+	defer r.Unlock()
+	return string(r.promptPrefix)
+}
+
+// SetPromptPrefix sets the text shown before the prompt, like the vim
+// mode indicator, and refreshes the line if needed.
+func (r *RuneBuffer) SetPromptPrefix(prefix string, refresh bool) {
+	r.Lock()
+	changed := string(r.promptPrefix) != prefix
+	if !refresh || !changed {
+		r.promptPrefix = []rune(prefix)
+		r.Unlock()
+		return
+	}
+	r.Unlock()
+	r.Refresh(func() {
+		r.promptPrefix = []rune(prefix)
+	})
+}
+
 func (r *RuneBuffer) cleanOutput(w io.Writer, idxLine int) {
 	buf := bufio.NewWriter(w)
 
@@ -617,7 +1211,8 @@ func (r *RuneBuffer) Clean() {
 }
 
 func (r *RuneBuffer) clean() {
-	r.cleanWithIdxLine(r.idxLine(r.width))
+	rows, _ := r.promptSize()
+	r.cleanWithIdxLine(r.idxLine(r.width) + rows)
 }
 
 func (r *RuneBuffer) cleanWithIdxLine(idxLine int) {
@@ -625,5 +1220,14 @@ func (r *RuneBuffer) cleanWithIdxLine(idxLine int) {
 		return
 	}
 	r.hadClean = true
-	r.cleanOutput(r.w, idxLine)
+	if !r.diffRender() {
+		r.cleanOutput(r.w, idxLine)
+		return
+	}
+	if r.screen != nil {
+		r.w.Write(r.screen.clear(r.width))
+	} else {
+		r.w.Write([]byte("\r\033[J"))
+	}
+	r.screen = nil
 }
@@ -0,0 +1,107 @@
+package readline
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chzyer/test"
+)
+
+func TestTransposeWords(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Idx  int
+		Ret  string
+		Pos  int
+		Ok   bool
+	}{
+		{"one two", 4, "two one", 7, true},
+		{"one two", 3, "two one", 7, true},
+		{"one two three", 5, "two one three", 7, true},
+		{"one two three", 13, "one three two", 13, true},
+		{"one, two!", 5, "two, one!", 8, true},
+		{"one, two!", 0, "one, two!", 0, false},
+		{"你好 世界", 3, "世界 你好", 5, true},
+		{"one", 1, "one", 1, false},
+	}
+	for i, r := range ret {
+		rb := newTestRuneBuffer(r.Line, r.Idx)
+		test.Equal(rb.TransposeWords(), r.Ok, fmt.Errorf("%v", i))
+		test.Equal(string(rb.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(rb.Pos(), r.Pos, fmt.Errorf("%v", i))
+	}
+}
+
+func TestCaseWord(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Idx  int
+		Op   func(*RuneBuffer)
+		Ret  string
+		Pos  int
+	}{
+		{"hello world", 0, (*RuneBuffer).UpcaseWord, "HELLO world", 5},
+		{"hello world", 5, (*RuneBuffer).UpcaseWord, "hello WORLD", 11},
+		{"HELLO World", 2, (*RuneBuffer).DowncaseWord, "HEllo World", 5},
+		{"hELLO world", 0, (*RuneBuffer).CapitalizeWord, "Hello world", 5},
+		{"  éCLAIR", 0, (*RuneBuffer).CapitalizeWord, "  Éclair", 8},
+		{"ǆungla", 0, (*RuneBuffer).CapitalizeWord, "ǅungla", 6},
+		{"straße", 0, (*RuneBuffer).UpcaseWord, "STRAßE", 6},
+	}
+	for i, r := range ret {
+		rb := newTestRuneBuffer(r.Line, r.Idx)
+		r.Op(rb)
+		test.Equal(string(rb.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(rb.Pos(), r.Pos, fmt.Errorf("%v", i))
+	}
+}
+
+func TestClusterMotion(t *testing.T) {
+	defer test.New(t)
+
+	family := "👨‍👩‍👧"
+	ret := []struct {
+		Line string
+		Idx  int
+		Op   func(*RuneBuffer)
+		Ret  string
+		Pos  int
+	}{
+		{"a" + family + "b", 1, (*RuneBuffer).MoveForward, "a" + family + "b", 6},
+		{"a" + family + "b", 6, (*RuneBuffer).MoveBackward, "a" + family + "b", 1},
+		{"a" + family + "b", 6, (*RuneBuffer).Backspace, "ab", 1},
+		{"a👍🏽b", 1, func(rb *RuneBuffer) { rb.Delete() }, "ab", 1},
+		{"🇨🇳🇺🇸", 4, (*RuneBuffer).Backspace, "🇨🇳", 2},
+		{"e\u0301x", 2, (*RuneBuffer).MoveBackward, "e\u0301x", 0},
+		{"e\u0301x", 2, (*RuneBuffer).Transpose, "xe\u0301", 3},
+		{"e\u0301", 0, (*RuneBuffer).Transpose, "e\u0301", 2},
+	}
+	for i, r := range ret {
+		rb := newTestRuneBuffer(r.Line, r.Idx)
+		r.Op(rb)
+		test.Equal(string(rb.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(rb.Pos(), r.Pos, fmt.Errorf("%v", i))
+	}
+}
+
+func TestBackspaceSequence(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Idx  int
+		Seq  string
+	}{
+		{"abc", 1, "\b\b"},
+		{"a你b", 1, "\b\b\b"},
+		{"a👍🏽b", 1, "\b\b\b"},
+	}
+	for i, r := range ret {
+		rb := newTestRuneBuffer(r.Line, r.Idx)
+		test.Equal(string(rb.getBackspaceSequence()), r.Seq, fmt.Errorf("%v", i))
+	}
+}
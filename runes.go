@@ -113,18 +113,22 @@ func (Runes) Index(r rune, rs []rune) int {
 	return -1
 }
 
+// ColorFilter removes the escape sequences and the runes between
+// CharIgnoreStart and CharIgnoreEnd, which don't take space on the screen
 func (Runes) ColorFilter(r []rune) []rune {
 	newr := make([]rune, 0, len(r))
+	ignore := false
 	for pos := 0; pos < len(r); pos++ {
-		if r[pos] == '\033' && r[pos+1] == '[' {
-			idx := runes.Index('m', r[pos+2:])
-			if idx == -1 {
-				continue
-			}
-			pos += idx + 2
-			continue
+		switch {
+		case r[pos] == '\033':
+			pos += escapeLen(r[pos:]) - 1
+		case r[pos] == CharIgnoreStart:
+			ignore = true
+		case r[pos] == CharIgnoreEnd:
+			ignore = false
+		case !ignore:
+			newr = append(newr, r[pos])
 		}
-		newr = append(newr, r[pos])
 	}
 	return newr
 }
@@ -134,31 +138,30 @@ var zeroWidth = []*unicode.RangeTable{
 	unicode.Me,
 	unicode.Cc,
 	unicode.Cf,
-}
-
-var doubleWidth = []*unicode.RangeTable{
-	unicode.Han,
-	unicode.Hangul,
-	unicode.Hiragana,
-	unicode.Katakana,
+	hangulJamoExtend,
 }
 
 func (Runes) Width(r rune) int {
 	if r == '\t' {
 		return TabWidth
 	}
+	if r >= 0x20 && r < 0x7F {
+		return 1
+	}
 	if unicode.IsOneOf(zeroWidth, r) {
 		return 0
 	}
-	if unicode.IsOneOf(doubleWidth, r) {
+	if unicode.Is(eastAsianWide, r) {
 		return 2
 	}
 	return 1
 }
 
 func (Runes) WidthAll(r []rune) (length int) {
-	for i := 0; i < len(r); i++ {
-		length += runes.Width(r[i])
+	for i := 0; i < len(r); {
+		n := runes.ClusterLen(r[i:])
+		length += runes.ClusterWidth(r[i : i+n])
+		i += n
 	}
 	return
 }
@@ -16,6 +16,14 @@ func TestRuneWidth(t *testing.T) {
 		{[]rune("a"), 1},
 		{[]rune("你"), 2},
 		{runes.ColorFilter([]rune("☭\033[13;1m你")), 3},
+		{[]rune("，"), 2},
+		{[]rune("e\u0301"), 1},
+		{[]rune("👍🏽"), 2},
+		{[]rune("👨\u200d👩\u200d👧"), 2},
+		{[]rune("🇨🇳"), 2},
+		{[]rune("🇨🇳🇺"), 3},
+		{[]rune("❤\ufe0f"), 2},
+		{[]rune("\u1112\u1161\u11ab"), 2},
 	}
 	for _, r := range rs {
 		if w := runes.WidthAll(r.r); w != r.length {
@@ -24,6 +32,54 @@ func TestRuneWidth(t *testing.T) {
 	}
 }
 
+func TestClusterLen(t *testing.T) {
+	rs := []struct {
+		r      []rune
+		length []int
+	}{
+		{[]rune("abc"), []int{1, 1, 1}},
+		{[]rune("e\u0301x"), []int{2, 1}},
+		{[]rune("a\r\nb"), []int{1, 2, 1}},
+		{[]rune("👍🏽!"), []int{2, 1}},
+		{[]rune("👨\u200d👩\u200d👧"), []int{5}},
+		{[]rune("a\u200d👩"), []int{2, 1}},
+		{[]rune("🇨🇳🇺🇸🇫"), []int{2, 2, 1}},
+		{[]rune("\u1112\u1161\u11ab한"), []int{3, 1}},
+		{[]rune("🏴\U000e0067\U000e0062\U000e007f"), []int{4}},
+	}
+	for _, r := range rs {
+		var length []int
+		for i := 0; i < len(r.r); {
+			n := runes.ClusterLen(r.r[i:])
+			length = append(length, n)
+			i += n
+		}
+		if !reflect.DeepEqual(length, r.length) {
+			t.Fatal("result not expect", string(r.r), r.length, length)
+		}
+	}
+}
+
+func TestColorFilter(t *testing.T) {
+	rs := []struct {
+		r []rune
+		e string
+	}{
+		{[]rune("\033[31mred\033[0m"), "red"},
+		{[]rune("\033[38;2;255;0;0mx\033[2K"), "x"},
+		{[]rune("\033]8;;https://example.com\033\\link\033]8;;\033\\"), "link"},
+		{[]rune("\033]0;title\a> "), "> "},
+		{[]rune("\001\033[1m\002> \001\033[0m\002"), "> "},
+		{[]rune("abc\033"), "abc"},
+		{[]rune("abc\033["), "abc"},
+	}
+	for _, r := range rs {
+		if e := string(runes.ColorFilter(r.r)); e != r.e {
+			t.Fatal("result not expect", string(r.r), r.e, e)
+		}
+	}
+}
+
 type tagg struct {
 	r      [][]rune
 	e      [][]rune
@@ -3,7 +3,6 @@ package readline
 import (
 	"bytes"
 	"container/list"
-	"fmt"
 	"io"
 )
 
@@ -113,6 +112,7 @@ func (o *opSearch) SearchMode(dir int) bool {
 }
 
 func (o *opSearch) ExitSearchMode(revert bool) {
+	o.buf.SetBelow(nil, false)
 	if revert {
 		o.history.current = o.source
 		o.buf.Set(o.history.showItem(o.history.current.Value))
@@ -130,21 +130,8 @@ func (o *opSearch) SearchRefresh(x int) {
 	} else if x >= 0 {
 		o.state = S_STATE_FOUND
 	}
-	if x < 0 {
-		x = o.buf.idx
-	}
-	x = o.buf.CurrentWidth(x)
-	x += o.buf.PromptLen()
-	x = x % o.width
-
-	if o.markStart > 0 {
-		o.buf.SetStyle(o.markStart, o.markEnd, "4")
-	}
 
-	lineCnt := o.buf.CursorLineCount()
 	buf := bytes.NewBuffer(nil)
-	buf.Write(bytes.Repeat([]byte("\n"), lineCnt))
-	buf.WriteString("\033[J")
 	if o.state == S_STATE_FAILING {
 		buf.WriteString("failing ")
 	}
@@ -154,11 +141,54 @@ func (o *opSearch) SearchRefresh(x int) {
 		buf.WriteString("fwd")
 	}
 	buf.WriteString("-i-search: ")
-	buf.WriteString(string(o.data))         // keyword
-	buf.WriteString("\033[4m \033[0m")      // _
-	fmt.Fprintf(buf, "\r\033[%dA", lineCnt) // move prev
-	if x > 0 {
-		fmt.Fprintf(buf, "\033[%dC", x) // move forward
+	buf.WriteString(string(o.data)) // keyword
+	o.writeBelow(buf.String())
+
+	if o.markStart > 0 {
+		o.buf.SetStyle(o.markStart, o.markEnd, "4")
 	}
-	o.w.Write(buf.Bytes())
+}
+
+// writeBelow shows the search line below the input
+func (o *opSearch) writeBelow(line string) {
+	o.buf.SetBelow([]string{line + "\033[4m \033[0m"}, true) // _
+}
+
+// VimSearchRefresh shows the pattern typed after vim's `/` or `?`
+func (o *opSearch) VimSearchRefresh(prefix rune, data []rune) {
+	if o.width == 0 {
+		return
+	}
+	o.writeBelow(string(prefix) + string(data))
+}
+
+// SearchHistory searches the history before or after the current one
+// count times, and shows the line found with the cursor on the match.
+// Unlike the incremental search, it's used by vim's `/` and `?`.
+func (o *opSearch) SearchHistory(dir int, data []rune, count int) bool {
+	if len(data) == 0 || o.history.current == nil {
+		return false
+	}
+	elem, idx := o.history.current, -1
+	for i := 0; i < count; i++ {
+		for {
+			if dir == S_DIR_BCK {
+				elem = elem.Prev()
+			} else {
+				elem = elem.Next()
+			}
+			if elem == nil {
+				return false
+			}
+			item := o.history.showItem(elem.Value)
+			idx = runes.IndexAllEx(item, data, o.cfg.HistorySearchFold)
+			if idx >= 0 {
+				break
+			}
+		}
+	}
+	o.history.Update(o.buf.Runes(), false)
+	o.history.current = elem
+	o.buf.SetWithIdx(idx, runes.Copy(o.history.showItem(elem.Value)))
+	return true
 }
@@ -20,6 +20,13 @@ type Terminal struct {
 	isReading int32
 	sleeping  int32
 
+	// the number of keys read by ReadRune, the terminal stops reading
+	// after sending the key numbered pauseAt. The next key may be read and
+	// paused at before the terminal checks, so the last one is kept too.
+	received    int32
+	pauseAt     int32
+	prevPauseAt int32
+
 	sizeChan chan string
 }
 
@@ -101,9 +108,29 @@ func (t *Terminal) ReadRune() rune {
 	if !ok {
 		return rune(0)
 	}
+	atomic.AddInt32(&t.received, 1)
 	return ch
 }
 
+// ReadRuneAndPause reads the next key like ReadRune, and the terminal
+// stops reading after it until KickRead, so that the program started by
+// the key can read the stdin itself.
+func (t *Terminal) ReadRuneAndPause() rune {
+	atomic.StoreInt32(&t.prevPauseAt, atomic.LoadInt32(&t.pauseAt))
+	atomic.StoreInt32(&t.pauseAt, atomic.LoadInt32(&t.received)+1)
+	return t.ReadRune()
+}
+
+// isPauseKey reports whether the terminal stops reading after the key
+// until KickRead, like after Enter
+func isPauseKey(r rune) bool {
+	switch r {
+	case CharInterrupt, CharEnter, CharCtrlJ, CharDelete:
+		return true
+	}
+	return false
+}
+
 func (t *Terminal) IsReading() bool {
 	return atomic.LoadInt32(&t.isReading) == 1
 }
@@ -127,8 +154,17 @@ func (t *Terminal) ioloop() {
 		isEscapeEx     bool
 		isEscapeSS3    bool
 		expectNextChar bool
+		sent           int32
 	)
 
+	send := func(r rune) {
+		sent++
+		t.outchan <- r
+		if atomic.LoadInt32(&t.pauseAt) == sent || atomic.LoadInt32(&t.prevPauseAt) == sent {
+			expectNextChar = false
+		}
+	}
+
 	buf := bufio.NewReader(t.getStdin())
 	for {
 		if !expectNextChar {
@@ -199,7 +235,7 @@ func (t *Terminal) ioloop() {
 		switch r {
 		case CharEsc:
 			if t.cfg.VimMode {
-				t.outchan <- r
+				send(r)
 				break
 			}
 			isEscape = true
@@ -207,7 +243,7 @@ func (t *Terminal) ioloop() {
 			expectNextChar = false
 			fallthrough
 		default:
-			t.outchan <- r
+			send(r)
 		}
 	}
 
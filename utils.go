@@ -40,6 +40,7 @@ const (
 	CharTranspose = 20
 	CharCtrlU     = 21
 	CharCtrlW     = 23
+	CharCtrlX     = 24
 	CharCtrlY     = 25
 	CharCtrlZ     = 26
 	CharEsc       = 27
@@ -54,6 +55,21 @@ const (
 	MetaDelete
 	MetaBackspace
 	MetaTranspose
+	MetaShiftTab
+	MetaMinus
+	MetaDigit0
+	MetaDigit1
+	MetaDigit2
+	MetaDigit3
+	MetaDigit4
+	MetaDigit5
+	MetaDigit6
+	MetaDigit7
+	MetaDigit8
+	MetaDigit9
+	MetaUpcase
+	MetaDowncase
+	MetaCapitalize
 )
 
 // WaitForResume need to call before current process got suspend.
@@ -115,6 +131,8 @@ func escapeExKey(key *escapeKeyPair) rune {
 		r = CharLineStart
 	case 'F':
 		r = CharLineEnd
+	case 'Z':
+		r = MetaShiftTab
 	case '~':
 		if key.attr == "3" {
 			r = CharDelete
@@ -192,10 +210,20 @@ func escapeKey(r rune, reader *bufio.Reader) rune {
 		r = MetaForward
 	case 'd':
 		r = MetaDelete
-	case CharTranspose:
+	case 't', CharTranspose:
 		r = MetaTranspose
+	case 'u':
+		r = MetaUpcase
+	case 'l':
+		r = MetaDowncase
+	case 'c':
+		r = MetaCapitalize
 	case CharBackspace:
 		r = MetaBackspace
+	case '-':
+		r = MetaMinus
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		r = MetaDigit0 - (r - '0')
 	case 'O':
 		d, _, _ := reader.ReadRune()
 		switch d {
@@ -216,10 +244,11 @@ func SplitByLine(start, screenWidth int, rs []rune) []string {
 	var ret []string
 	buf := bytes.NewBuffer(nil)
 	currentWidth := start
-	for _, r := range rs {
-		w := runes.Width(r)
-		currentWidth += w
-		buf.WriteRune(r)
+	for i := 0; i < len(rs); {
+		n := runes.ClusterLen(rs[i:])
+		currentWidth += runes.ClusterWidth(rs[i : i+n])
+		buf.WriteString(string(rs[i : i+n]))
+		i += n
 		if currentWidth >= screenWidth {
 			ret = append(ret, buf.String())
 			buf.Reset()
@@ -1,21 +1,74 @@
 package readline
 
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
 const (
 	VIM_NORMAL = iota
 	VIM_INSERT
 	VIM_VISUAL
+	VIM_REPLACE
+)
+
+// the cursor shapes set by DECSCUSR, see Config.VimCursorShape
+const (
+	vimCursorDefault   = 0
+	vimCursorBlock     = 2
+	vimCursorUnderline = 4
+	vimCursorBeam      = 6
 )
 
 type opVim struct {
 	cfg     *Config
 	op      *Operation
 	vimMode int
+
+	// the other end of the selection in visual mode
+	visualStart int
+	// select the whole line in visual mode
+	visualLine bool
+
+	lastChange *vimChange
+	// record the runes typed in insert mode to lastChange
+	recordInsert bool
+
+	registers *vimRegisters
+	// the register specified by `"x` for the next command
+	register rune
+
+	// the cursor shape we set, vimCursorDefault if it's untouched
+	cursorShape int
+
+	// the clusters overwritten in replace mode, restored by backspace,
+	// nil if the rune is appended
+	replaced [][]rune
+	// the last f/t/F/T and its char, repeated by `;` and `,`
+	lastFind [2]rune
+
+	// the states before each change, restored by `u` and Ctrl-R
+	undoStack []vimState
+	redoStack []vimState
+	// the state after the last change
+	undoBase vimState
+
+	// the last pattern of `/` and `?`, repeated by `n` and `N`
+	lastSearch    []rune
+	lastSearchDir int
+}
+
+type vimState struct {
+	buf []rune
+	idx int
 }
 
 func newVimMode(op *Operation) *opVim {
 	ov := &opVim{
-		cfg: op.cfg,
-		op:  op,
+		cfg:       op.cfg,
+		op:        op,
+		registers: newVimRegisters(),
 	}
 	ov.SetVimMode(ov.cfg.VimMode)
 	return ov
@@ -26,142 +79,972 @@ func (o *opVim) SetVimMode(on bool) {
 		o.ExitVimMode()
 	}
 	o.cfg.VimMode = on
-	o.vimMode = VIM_INSERT
+	o.switchVimMode(VIM_INSERT)
 }
 
+// ExitVimMode resets to insert mode after the line is accepted or
+// interrupted, the indicator is updated in the next Readline.
 func (o *opVim) ExitVimMode() {
 	o.vimMode = VIM_INSERT
 }
 
+func (o *opVim) switchVimMode(mode int) {
+	o.vimMode = mode
+	indicator, shape := o.vimModeStyle()
+	reading := o.op.t.IsReading()
+	if reading {
+		o.setCursorShape(shape)
+	}
+	o.op.buf.SetPromptPrefix(indicator, reading)
+}
+
+// return the indicator and the cursor shape of the current mode
+func (o *opVim) vimModeStyle() (indicator string, shape int) {
+	cfg := o.op.cfg
+	if !cfg.VimMode {
+		return "", vimCursorDefault
+	}
+	switch o.vimMode {
+	case VIM_INSERT:
+		indicator, shape = cfg.VimInsertIndicator, vimCursorBeam
+	case VIM_NORMAL:
+		indicator, shape = cfg.VimNormalIndicator, vimCursorBlock
+	case VIM_VISUAL:
+		indicator, shape = cfg.VimVisualIndicator, vimCursorBlock
+		if indicator == "" {
+			indicator = cfg.VimNormalIndicator
+		}
+	case VIM_REPLACE:
+		indicator, shape = cfg.VimReplaceIndicator, vimCursorUnderline
+		if indicator == "" {
+			indicator = cfg.VimInsertIndicator
+		}
+	}
+	if !cfg.VimCursorShape {
+		shape = vimCursorDefault
+	}
+	return indicator, shape
+}
+
+// beginVimLine shows the mode before Readline prints the prompt
+func (o *opVim) beginVimLine() {
+	indicator, shape := o.vimModeStyle()
+	o.setCursorShape(shape)
+	o.op.buf.SetPromptPrefix(indicator, false)
+	o.undoStack, o.redoStack = nil, nil
+	o.undoBase = o.vimState()
+}
+
+func (o *opVim) vimState() vimState {
+	return vimState{o.op.buf.Runes(), o.op.buf.Pos()}
+}
+
+// commitVimUndo saves the state before the last change, it's called
+// when we are back to normal mode.
+func (o *opVim) commitVimUndo() {
+	cur := o.vimState()
+	if runes.Equal(cur.buf, o.undoBase.buf) {
+		o.undoBase.idx = cur.idx
+		return
+	}
+	o.undoStack = append(o.undoStack, o.undoBase)
+	o.redoStack = nil
+	o.undoBase = cur
+}
+
+// undoVim restores the state by `u`, or by Ctrl-R if redo is true
+func (o *opVim) undoVim(redo bool, count int) bool {
+	from, to := &o.undoStack, &o.redoStack
+	if redo {
+		from, to = to, from
+	}
+	if len(*from) == 0 {
+		return false
+	}
+	for i := 0; i < count && len(*from) > 0; i++ {
+		*to = append(*to, o.undoBase)
+		o.undoBase = (*from)[len(*from)-1]
+		*from = (*from)[:len(*from)-1]
+	}
+	o.op.buf.SetWithIdx(o.undoBase.idx, runes.Copy(o.undoBase.buf))
+	o.fixVimCursor()
+	return true
+}
+
+func (o *opVim) setCursorShape(shape int) {
+	if shape == o.cursorShape || !o.op.cfg.useInteractive() {
+		return
+	}
+	o.cursorShape = shape
+	o.op.t.Write([]byte("\033[" + strconv.Itoa(shape) + " q"))
+}
+
+// restore the cursor shape when Readline returns
+func (o *opVim) resetCursorShape() {
+	o.setCursorShape(vimCursorDefault)
+}
+
 func (o *opVim) IsEnableVimMode() bool {
 	return o.cfg.VimMode
 }
 
-func (o *opVim) handleVimNormalMovement(r rune, readNext func() rune) (t rune, handled bool) {
+// vimChange is the last change made in normal mode, which is repeated by `.`
+type vimChange struct {
+	count    int
+	register rune
+	// the command and the keys it read
+	keys []rune
+	// the runes typed in insert mode if the command entered it
+	insert []rune
+}
+
+func isVimDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// read the count before a command, the count is 0 if there is none,
+// the digits over argumentMax are ignored like the numeric argument.
+func readVimCount(r rune, readNext func() rune) (rune, int) {
+	count := 0
+	for isVimDigit(r) && (r != '0' || count > 0) {
+		if digit := int(r - '0'); count*10+digit <= argumentMax {
+			count = count*10 + digit
+		}
+		r = readNext()
+	}
+	return r, count
+}
+
+// multiply the counts of the command and the motion up to argumentMax
+func mulVimCount(count, count2 int) int {
+	if count > argumentMax/count2 {
+		return argumentMax
+	}
+	return count * count2
+}
+
+// handleVimNormalCommand executes a command in normal mode, it reports
+// whether the command changes the buffer so that it can be repeated.
+func (o *opVim) handleVimNormalCommand(r rune, count int, readNext func() rune) (t rune, change, ok bool) {
 	rb := o.op.buf
-	handled = true
+	n := count
+	if n == 0 {
+		n = 1
+	}
+
 	switch r {
-	case 'h':
-		t = CharBackward
-	case 'j':
-		t = CharNext
-	case 'k':
-		t = CharPrev
-	case 'l':
-		t = CharForward
-	case '0', '^':
-		rb.MoveToLineStart()
-	case '$':
-		rb.MoveToLineEnd()
+	case 'j', 'k':
+		return 0, false, o.moveVimHistory(r == 'k', n)
 	case 'x':
-		rb.Delete()
 		if rb.IsCursorInEnd() {
-			rb.MoveBackward()
+			return 0, false, false
+		}
+		o.cutVim(rb.Pos(), vimClusterEnd(rb.Runes(), rb.Pos(), n), false)
+		o.fixVimCursor()
+		return 0, true, true
+	case 'X':
+		return 0, true, o.handleVimOperator("d", count, vimKeys("h"))
+	case 'D':
+		return 0, true, o.handleVimOperator("d", count, vimKeys("$"))
+	case 'C':
+		return 0, true, o.handleVimOperator("c", count, vimKeys("$"))
+	case '~':
+		idx, buf := rb.Pos(), rb.Runes()
+		if idx >= len(buf) {
+			return 0, false, false
+		}
+		end := vimClusterEnd(buf, idx, n)
+		if !rb.MapRunes(idx, end, toggleCase) {
+			return 0, false, false
+		}
+		rb.SetPos(end)
+		o.fixVimCursor()
+		return 0, true, true
+	case CharLineStart, CharCtrlX:
+		if r == CharCtrlX {
+			n = -n
 		}
+		return 0, true, o.increaseVim(n)
+	case 'u', CharBckSearch:
+		return 0, false, o.undoVim(r == CharBckSearch, n)
+	case '/', '?':
+		return 0, false, o.searchVim(r, n, readNext)
+	case 'n', 'N':
+		dir := o.lastSearchDir
+		if r == 'N' {
+			dir = S_DIR_BCK + S_DIR_FWD - dir
+		}
+		if !o.op.SearchHistory(dir, o.lastSearch, n) {
+			return 0, false, false
+		}
+		o.fixVimCursor()
+		return 0, false, true
+	case 'R':
+		o.replaced = nil
+		o.switchVimMode(VIM_REPLACE)
+		return 0, true, true
 	case 'r':
-		rb.Replace(readNext())
-	case 'd':
 		next := readNext()
-		switch next {
-		case 'd':
-			rb.Erase()
-		case 'w':
-			rb.DeleteWord()
-		case 'h':
-			rb.Backspace()
-		case 'l':
-			rb.Delete()
+		if next == CharInterrupt {
+			o.ExitVimMode()
+			return next, false, true
 		}
-	case 'p':
-		rb.Yank()
-	case 'b', 'B':
-		rb.MoveToPrevWord()
-	case 'w', 'W':
-		rb.MoveToNextWord()
-	case 'e', 'E':
-		rb.MoveToEndWord()
-	case 'f', 'F', 't', 'T':
+		idx, buf := rb.Pos(), rb.Runes()
+		// each of the n clusters is replaced by one rune
+		if !IsPrintable(next) || next == CharBackspace || vimClusterEnd(buf, idx, n-1) >= len(buf) {
+			return 0, false, false
+		}
+		end := vimClusterEnd(buf, idx, n)
+		newBuf := append(runes.Copy(buf[:idx]), []rune(strings.Repeat(string(next), n))...)
+		newBuf = append(newBuf, buf[end:]...)
+		if !rb.allowLine(newBuf) {
+			return 0, false, false
+		}
+		rb.SetWithIdx(idx+n-1, newBuf)
+		return 0, true, true
+	case 'p', 'P':
+		return 0, true, o.pasteVim(r == 'P', n)
+	case 'Y':
+		start, end := vimLineRange(rb.Runes(), rb.Pos())
+		o.yankVim(start, end)
+		return 0, false, true
+	case 'd', 'c', 'y', '>', '<':
+		return 0, r != 'y', o.handleVimOperator(string(r), count, readNext)
+	case 'g':
 		next := readNext()
-		prevChar := r == 't' || r == 'T'
-		reverse := r == 'F' || r == 'T'
 		switch next {
-		case CharEsc:
-		default:
-			rb.MoveTo(next, prevChar, reverse)
+		case 'u', 'U', '~':
+			return 0, true, o.handleVimOperator("g"+string(next), count, readNext)
 		}
-	default:
-		return r, false
+		return 0, false, false
+	case 'i', 'I', 'a', 'A', 's', 'S':
+		switch r {
+		case 'I':
+			rb.MoveToLineStart()
+		case 'a':
+			rb.MoveForward()
+		case 'A':
+			rb.MoveToLineEnd()
+		case 's':
+			o.cutVim(rb.Pos(), vimClusterEnd(rb.Runes(), rb.Pos(), n), false)
+		case 'S':
+			start, end := vimLineRange(rb.Runes(), rb.Pos())
+			o.cutVim(start, end, true)
+		}
+		o.EnterVimInsertMode()
+		return 0, true, true
+	case 'v', 'V':
+		if r == 'v' && o.cfg.VimEditorKey {
+			// the terminal waits after `v` only if it's typed without a
+			// count or register, see Operation.isVimEditorMode
+			if count > 0 || o.register != 0 {
+				return 0, false, false
+			}
+			t := o.op.runEditor()
+			o.fixVimCursor()
+			return t, false, true
+		}
+		o.EnterVimVisualMode(r == 'V')
+		return 0, false, true
 	}
-	return t, true
+
+	buf, idx := rb.Runes(), rb.Pos()
+	pos, _, ok := o.runVimMotion(r, buf, idx, n, readNext)
+	if !ok {
+		return 0, false, false
+	}
+	rb.SetPos(pos)
+	o.fixVimCursor()
+	return 0, false, true
 }
 
-func (o *opVim) handleVimNormalEnterInsert(r rune, readNext func() rune) (t rune, handled bool) {
+// handleVimOperator reads the motion of the operator and applies the
+// operator to the text it moves over, `dd`, `cc`, `guu` etc. apply
+// to the whole line.
+func (o *opVim) handleVimOperator(op string, count int, readNext func() rune) bool {
 	rb := o.op.buf
-	handled = true
-	switch r {
-	case 'i':
-	case 'I':
-		rb.MoveToLineStart()
-	case 'a':
-		rb.MoveForward()
-	case 'A':
-		rb.MoveToLineEnd()
-	case 's':
-		rb.Delete()
-	case 'S':
-		rb.Erase()
-	case 'c':
-		next := readNext()
-		switch next {
-		case 'c':
-			rb.Erase()
-		case 'w':
-			rb.DeleteWord()
-		case 'h':
-			rb.Backspace()
-		case 'l':
-			rb.Delete()
+	m, count2 := readVimCount(readNext(), readNext)
+	if count == 0 {
+		count = 1
+	}
+	if count2 > 0 {
+		count = mulVimCount(count, count2)
+	}
+
+	buf, idx := rb.Runes(), rb.Pos()
+	var start, end int
+	linewise := false
+	last := rune(op[len(op)-1])
+	switch {
+	case m == last || (op[0] == 'g' && m == 'g' && readNext() == last):
+		start, end = vimLineRange(buf, idx)
+		linewise = true
+	case m == 'i' || m == 'a':
+		var ok bool
+		start, end, ok = vimTextObject(buf, idx, m == 'a', readNext())
+		if !ok {
+			return false
 		}
 	default:
-		return r, false
+		// `cw` changes to the end of word like `ce`, but the word the
+		// cursor is at the end of counts as the first one like vim
+		pos, ok := idx, true
+		if op == "c" && (m == 'w' || m == 'W') && idx < len(buf) && !unicode.IsSpace(buf[idx]) {
+			m += 'e' - 'w'
+			next := runes.NextCluster(buf, idx)
+			if next >= len(buf) || vimCharClass(buf[next], m == 'E') != vimCharClass(buf[idx], m == 'E') {
+				count--
+			}
+		}
+		if count > 0 {
+			pos, m, ok = o.runVimMotion(m, buf, idx, count, readNext)
+			if !ok {
+				return false
+			}
+		}
+		start, end = idx, pos
+		if start > end {
+			start, end = end, start
+		}
+		if vimMotionInclusive(m) {
+			end = runes.NextCluster(buf, end)
+		}
+	}
+
+	switch op {
+	case "d":
+		o.cutVim(start, end, linewise)
+		o.fixVimCursor()
+	case "c":
+		o.cutVim(start, end, linewise)
+		o.EnterVimInsertMode()
+	case "y":
+		o.yankVim(start, end)
+		rb.SetPos(start)
+	case ">", "<":
+		return o.indentVim(op == ">", start)
+	case "gu", "gU", "g~":
+		f := unicode.ToLower
+		if op == "gU" {
+			f = unicode.ToUpper
+		} else if op == "g~" {
+			f = toggleCase
+		}
+		if !rb.MapRunes(start, end, f) {
+			return false
+		}
+		rb.SetPos(start)
+	}
+	return true
+}
+
+// searchVim reads the pattern after `/` or `?` until Enter, and searches
+// the history for it, `/` searches the older lines like bash's vi mode.
+func (o *opVim) searchVim(prefix rune, count int, readNext func() rune) bool {
+	var data []rune
+read:
+	for {
+		o.op.VimSearchRefresh(prefix, data)
+		switch r := readNext(); r {
+		case CharEnter:
+			break read
+		case CharBackspace, CharCtrlH:
+			if len(data) == 0 {
+				o.op.buf.SetBelow(nil, true)
+				return true
+			}
+			data = data[:len(data)-1]
+		case CharEsc, CharBell, CharInterrupt:
+			o.op.buf.SetBelow(nil, true)
+			return true
+		default:
+			if IsPrintable(r) {
+				data = append(data, r)
+			}
+		}
+	}
+	o.op.buf.SetBelow(nil, true)
+
+	// an empty pattern searches the last one
+	if len(data) > 0 {
+		o.lastSearch = data
+	}
+	o.lastSearchDir = S_DIR_BCK
+	if prefix == '?' {
+		o.lastSearchDir = S_DIR_FWD
+	}
+	if !o.op.SearchHistory(o.lastSearchDir, o.lastSearch, count) {
+		return false
+	}
+	o.fixVimCursor()
+	return true
+}
+
+// moveVimHistory moves n lines back in the history like `k`, or forward
+// like `j`, it stops at the first or the last line like vim.
+func (o *opVim) moveVimHistory(prev bool, n int) bool {
+	history := o.op.history
+	// keep the line edited before leaving it
+	history.Update(o.op.buf.Runes(), false)
+	var line []rune
+	for i := 0; i < n; i++ {
+		var item []rune
+		if prev {
+			item = history.Prev()
+		} else if next, ok := history.Next(); ok {
+			// the last line may be empty
+			item = append([]rune{}, next...)
+		}
+		if item == nil {
+			break
+		}
+		line = item
+	}
+	if line == nil {
+		return false
+	}
+	o.op.buf.Set(line)
+	return true
+}
+
+// return a readNext which reads the keys
+func vimKeys(keys string) func() rune {
+	rs := []rune(keys)
+	return func() rune {
+		if len(rs) == 0 {
+			return CharEsc
+		}
+		r := rs[0]
+		rs = rs[1:]
+		return r
+	}
+}
+
+// runVimMotion runs the motion like vimMotion, besides it remembers the
+// last f/t/F/T and repeats it by `;` and `,`. It returns the motion which
+// is actually run.
+func (o *opVim) runVimMotion(r rune, buf []rune, idx, count int, readNext func() rune) (int, rune, bool) {
+	switch r {
+	case 'f', 'F', 't', 'T':
+		ch := readNext()
+		pos, ok := vimMotion(r, buf, idx, count, vimKeys(string(ch)))
+		if ch != CharEsc {
+			o.lastFind = [2]rune{r, ch}
+		}
+		return pos, r, ok
+	case ';', ',':
+		reverse := r == ','
+		r, ch := o.lastFind[0], o.lastFind[1]
+		if r == 0 {
+			return idx, r, false
+		}
+		if reverse {
+			r = toggleCase(r)
+		}
+		pos, ok := vimMotion(r, buf, idx, count, vimKeys(string(ch)))
+		// the cursor is just before the char, so skip it
+		if ok && pos == idx && (r == 't' || r == 'T') {
+			from := idx + 1
+			if r == 'T' {
+				from = idx - 1
+			}
+			pos, ok = vimMotion(r, buf, from, count, vimKeys(string(ch)))
+		}
+		return pos, r, ok
 	}
+	pos, ok := vimMotion(r, buf, idx, count, readNext)
+	return pos, r, ok
+}
 
-	o.EnterVimInsertMode()
-	return
+// increaseVim adds delta to the number under or after the cursor
+func (o *opVim) increaseVim(delta int) bool {
+	rb := o.op.buf
+	buf, idx := rb.Runes(), rb.Pos()
+	_, lineEnd := vimLineRange(buf, idx)
+	start := idx
+	for start < lineEnd && !isVimDigit(buf[start]) {
+		start++
+	}
+	if start == lineEnd {
+		return false
+	}
+	for start > 0 && isVimDigit(buf[start-1]) {
+		start--
+	}
+	end := start
+	for end < lineEnd && isVimDigit(buf[end]) {
+		end++
+	}
+	if start > 0 && buf[start-1] == '-' {
+		start--
+	}
+	num, err := strconv.Atoi(string(buf[start:end]))
+	if err != nil {
+		return false
+	}
+	sum := num + delta
+	if delta != 0 && (sum > num) != (delta > 0) {
+		// overflow
+		return false
+	}
+	text := []rune(strconv.Itoa(sum))
+	newBuf := make([]rune, 0, len(buf)-(end-start)+len(text))
+	newBuf = append(newBuf, buf[:start]...)
+	newBuf = append(newBuf, text...)
+	newBuf = append(newBuf, buf[end:]...)
+	if !rb.allowLine(newBuf) {
+		return false
+	}
+	rb.SetWithIdx(start+len(text)-1, newBuf)
+	return true
+}
+
+// cut the runes in [start, end) to the register
+func (o *opVim) cutVim(start, end int, linewise bool) {
+	if end > o.op.buf.Len() {
+		end = o.op.buf.Len()
+	}
+	text := o.op.buf.Cut(start, end)
+	if o.registers.Delete(o.register, text, linewise) {
+		o.syncClipboard()
+	}
+}
+
+// copy the runes in [start, end) to the register
+func (o *opVim) yankVim(start, end int) {
+	buf := o.op.buf.Runes()
+	if end > len(buf) {
+		end = len(buf)
+	}
+	if start > end {
+		start = end
+	}
+	text := buf[start:end]
+	if o.registers.Yank(o.register, text) {
+		o.syncClipboard()
+	}
+}
+
+func (o *opVim) syncClipboard() {
+	if f := o.op.cfg.FuncVimClipboard; f != nil {
+		f(o.registers.Get(0))
+	}
+}
+
+// paste the register count times after the cursor, or before it like `P`
+func (o *opVim) pasteVim(before bool, count int) bool {
+	text := o.registers.Get(o.register)
+	if len(text) == 0 || len(text) > argumentMax/count {
+		return false
+	}
+	rb := o.op.buf
+	idx := rb.Pos()
+	if !before && idx < rb.Len() {
+		rb.SetPos(idx + 1)
+	}
+	paste := make([]rune, 0, len(text)*count)
+	for i := 0; i < count; i++ {
+		paste = append(paste, text...)
+	}
+	idx = rb.Pos()
+	success := rb.Insert(paste)
+	// the cursor is on the last pasted rune
+	if pos := rb.Pos(); pos > idx {
+		rb.SetPos(pos - 1)
+	}
+	return success
+}
+
+// shift the line contains pos by TabWidth spaces
+func (o *opVim) indentVim(right bool, pos int) bool {
+	rb := o.op.buf
+	buf := rb.Runes()
+	start, end := vimLineRange(buf, pos)
+	if right {
+		if start == end {
+			// the empty line isn't indented like vim
+			return true
+		}
+		indent := []rune(strings.Repeat(" ", TabWidth))
+		buf = append(buf[:start], append(indent, buf[start:]...)...)
+	} else {
+		n := 0
+		for n < TabWidth && start+n < len(buf) && buf[start+n] == ' ' {
+			n++
+		}
+		buf = append(buf[:start], buf[start+n:]...)
+	}
+	if !rb.allowLine(buf) {
+		return false
+	}
+	idx := start
+	for idx < len(buf)-1 && unicode.IsSpace(buf[idx]) {
+		idx++
+	}
+	rb.SetWithIdx(idx, buf)
+	return true
+}
+
+// vimClusterEnd returns the index after n grapheme clusters from idx
+func vimClusterEnd(buf []rune, idx, n int) int {
+	for i := 0; i < n && idx < len(buf); i++ {
+		idx = runes.NextCluster(buf, idx)
+	}
+	return idx
+}
+
+// the cursor is on the last rune instead of the end of line in normal mode
+func (o *opVim) fixVimCursor() {
+	rb := o.op.buf
+	if rb.IsCursorInEnd() && rb.Len() > 0 {
+		rb.MoveBackward()
+	}
 }
 
 func (o *opVim) HandleVimNormal(r rune, readNext func() rune) (t rune) {
 	switch r {
-	case CharEnter, CharInterrupt:
+	// the terminal waits after Ctrl-J like Enter, the mode is reset after
+	// the line is accepted
+	case CharEnter, CharCtrlJ:
+		return r
+	case CharInterrupt:
 		o.ExitVimMode()
 		return r
 	}
 
-	if r, handled := o.handleVimNormalMovement(r, readNext); handled {
-		return r
+	r, count, ok := o.readVimPrefix(r, readNext)
+	if !ok {
+		o.op.t.Bell()
+		return 0
+	}
+	defer func() {
+		o.register = 0
+	}()
+	if r == '.' {
+		return o.repeatVimChange(count)
 	}
 
-	if r, handled := o.handleVimNormalEnterInsert(r, readNext); handled {
+	keys := []rune{r}
+	record := func() rune {
+		next := readNext()
+		keys = append(keys, next)
+		return next
+	}
+	t, change, ok := o.handleVimNormalCommand(r, count, record)
+	if !ok {
+		// invalid operation
+		o.op.t.Bell()
+		return 0
+	}
+	if change {
+		o.lastChange = &vimChange{count: count, register: o.register, keys: keys}
+		o.recordInsert = o.vimMode == VIM_INSERT || o.vimMode == VIM_REPLACE
+	}
+	return t
+}
+
+// readVimPrefix reads the count and the register in the form of
+// `[count]["x][count]` before a command.
+func (o *opVim) readVimPrefix(r rune, readNext func() rune) (rune, int, bool) {
+	r, count := readVimCount(r, readNext)
+	if r != '"' {
+		return r, count, true
+	}
+	reg := readNext()
+	if !isVimRegister(reg) {
+		return r, count, false
+	}
+	o.register = reg
+	r, count2 := readVimCount(readNext(), readNext)
+	if count2 > 0 {
+		if count == 0 {
+			count = 1
+		}
+		count = mulVimCount(count, count2)
+	}
+	return r, count, true
+}
+
+// repeatVimChange repeats the last change, the count replaces the
+// original one if it's given.
+func (o *opVim) repeatVimChange(count int) rune {
+	c := o.lastChange
+	if c == nil {
+		o.op.t.Bell()
+		return 0
+	}
+	if count > 0 {
+		c.count = count
+	}
+	if o.register == 0 {
+		o.register = c.register
+	}
+
+	keys := c.keys[1:]
+	readNext := func() rune {
+		if len(keys) == 0 {
+			return CharEsc
+		}
+		r := keys[0]
+		keys = keys[1:]
 		return r
 	}
+	t, _, ok := o.handleVimNormalCommand(c.keys[0], c.count, readNext)
+	if !ok {
+		o.op.t.Bell()
+		return 0
+	}
+	switch o.vimMode {
+	case VIM_INSERT:
+		for _, r := range c.insert {
+			o.replayVimInsert(r)
+		}
+		o.ExitVimInsertMode()
+	case VIM_REPLACE:
+		for _, r := range c.insert {
+			o.handleVimReplace(r)
+		}
+		o.ExitVimInsertMode()
+	}
+	return t
+}
 
-	// invalid operation
-	o.op.t.Bell()
-	return 0
+// replayVimInsert runs the key typed in insert mode again like ioloop, the
+// keys which don't edit the line are skipped.
+func (o *opVim) replayVimInsert(r rune) {
+	rb := o.op.buf
+	switch r {
+	case CharBackspace, CharCtrlH:
+		rb.Backspace()
+	case CharDelete:
+		rb.Delete()
+	case CharCtrlW:
+		rb.BackEscapeWord()
+	case CharCtrlU:
+		rb.KillFront()
+	case CharKill:
+		rb.Kill()
+	case CharCtrlY:
+		rb.Yank()
+	case CharTranspose:
+		rb.Transpose()
+	case CharLineStart:
+		rb.MoveToLineStart()
+	case CharLineEnd:
+		rb.MoveToLineEnd()
+	case CharBackward:
+		rb.MoveBackward()
+	case CharForward:
+		rb.MoveForward()
+	default:
+		if IsPrintable(r) && !rb.Insert([]rune{r}) {
+			o.op.t.Bell()
+		}
+	}
 }
 
 func (o *opVim) EnterVimInsertMode() {
-	o.vimMode = VIM_INSERT
+	o.switchVimMode(VIM_INSERT)
 }
 
+// ExitVimInsertMode enters normal mode, the cursor moves back onto the
+// last inserted rune like vim.
 func (o *opVim) ExitVimInsertMode() {
-	o.vimMode = VIM_NORMAL
+	o.switchVimMode(VIM_NORMAL)
+	o.recordInsert = false
+	o.replaced = nil
+	o.op.buf.MoveBackward()
+}
+
+// handleVimReplace overwrites the rune under the cursor in replace mode,
+// backspace restores the overwritten one.
+func (o *opVim) handleVimReplace(r rune) {
+	rb := o.op.buf
+	buf, idx := rb.Runes(), rb.Pos()
+	switch {
+	case r == CharBackspace || r == CharCtrlH:
+		if len(o.replaced) == 0 {
+			rb.MoveBackward()
+			return
+		}
+		orig := o.replaced[len(o.replaced)-1]
+		o.replaced = o.replaced[:len(o.replaced)-1]
+		if orig == nil {
+			rb.Backspace()
+			return
+		}
+		start := idx - 1
+		newBuf := append(append(runes.Copy(buf[:start]), orig...), buf[idx:]...)
+		rb.SetWithIdx(start, newBuf)
+	case IsPrintable(r):
+		if idx == len(buf) {
+			if !rb.Insert([]rune{r}) {
+				o.op.t.Bell()
+				return
+			}
+			o.replaced = append(o.replaced, nil)
+			return
+		}
+		// the whole cluster under the cursor is overwritten
+		end := runes.NextCluster(buf, idx)
+		newBuf := append(append(runes.Copy(buf[:idx]), r), buf[end:]...)
+		if !rb.allowLine(newBuf) {
+			o.op.t.Bell()
+			return
+		}
+		o.replaced = append(o.replaced, runes.Copy(buf[idx:end]))
+		rb.SetWithIdx(idx+1, newBuf)
+	}
+}
+
+func (o *opVim) EnterVimVisualMode(line bool) {
+	rb := o.op.buf
+	if rb.Len() == 0 {
+		o.op.t.Bell()
+		return
+	}
+	if rb.IsCursorInEnd() {
+		rb.MoveBackward()
+	}
+	o.switchVimMode(VIM_VISUAL)
+	o.visualStart = rb.Pos()
+	o.visualLine = line
+	o.visualRefresh()
+}
+
+func (o *opVim) ExitVimVisualMode() {
+	o.switchVimMode(VIM_NORMAL)
+	o.op.buf.Refresh(nil)
+}
+
+// return the selection in [start, end)
+func (o *opVim) visualRange() (start, end int) {
+	buf := o.op.buf.Runes()
+	start, end = o.visualStart, o.op.buf.Pos()
+	if start > end {
+		start, end = end, start
+	}
+	if o.visualLine {
+		start, _ = vimLineRange(buf, start)
+		_, end = vimLineRange(buf, end)
+		return start, end
+	}
+	// the cluster under the cursor is selected as a whole
+	return start, vimClusterEnd(buf, end, 1)
+}
+
+// highlight the selection
+func (o *opVim) visualRefresh() {
+	rb := o.op.buf
+	rb.Refresh(nil)
+	start, end := o.visualRange()
+	if start < end {
+		rb.SetStyle(start, end, "7")
+	}
+}
+
+func (o *opVim) HandleVimVisual(r rune, readNext func() rune) rune {
+	rb := o.op.buf
+	switch r {
+	case CharEnter, CharCtrlJ:
+		return r
+	case CharInterrupt:
+		o.ExitVimMode()
+		return r
+	case CharEsc, CharBell:
+		o.ExitVimVisualMode()
+		return 0
+	case 'v', 'V':
+		line := r == 'V'
+		if o.visualLine == line {
+			o.ExitVimVisualMode()
+			return 0
+		}
+		o.visualLine = line
+	case 'o':
+		pos := rb.Pos()
+		rb.SetPos(o.visualStart)
+		o.visualStart = pos
+	case 'i', 'a':
+		start, end, ok := vimTextObject(rb.Runes(), rb.Pos(), r == 'a', readNext())
+		if !ok {
+			o.op.t.Bell()
+			break
+		}
+		o.visualStart = start
+		rb.SetPos(end - 1)
+	case '"':
+		reg := readNext()
+		if !isVimRegister(reg) {
+			o.op.t.Bell()
+			break
+		}
+		o.register = reg
+		return 0
+	case 'd', 'x', 'X', 'D':
+		start, end := o.visualRange()
+		o.cutVim(start, end, o.visualLine)
+		o.register = 0
+		o.fixVimCursor()
+		o.switchVimMode(VIM_NORMAL)
+		return 0
+	case 'c', 's', 'S', 'C':
+		start, end := o.visualRange()
+		o.cutVim(start, end, o.visualLine)
+		o.register = 0
+		o.EnterVimInsertMode()
+		return 0
+	case 'y', 'Y':
+		start, end := o.visualRange()
+		o.yankVim(start, end)
+		o.register = 0
+		rb.SetPos(start)
+		o.ExitVimVisualMode()
+		return 0
+	case '~', 'u', 'U':
+		f := unicode.ToLower
+		if r == 'U' {
+			f = unicode.ToUpper
+		} else if r == '~' {
+			f = toggleCase
+		}
+		start, end := o.visualRange()
+		if !rb.MapRunes(start, end, f) {
+			o.op.t.Bell()
+		}
+		rb.SetPos(start)
+		o.ExitVimVisualMode()
+		return 0
+	default:
+		r, count := readVimCount(r, readNext)
+		buf := rb.Runes()
+		pos, ok := vimMotion(r, buf, rb.Pos(), count, readNext)
+		if !ok {
+			o.op.t.Bell()
+			break
+		}
+		// the cursor is always on a rune in visual mode
+		if pos >= len(buf) {
+			pos = runes.PrevCluster(buf, len(buf))
+		}
+		rb.SetPos(pos)
+	}
+	o.visualRefresh()
+	return 0
 }
 
 func (o *opVim) HandleVim(r rune, readNext func() rune) rune {
+	defer func() {
+		if o.vimMode == VIM_NORMAL {
+			o.commitVimUndo()
+		}
+	}()
 	if o.vimMode == VIM_NORMAL {
 		return o.HandleVimNormal(r, readNext)
 	}
+	if o.vimMode == VIM_VISUAL {
+		return o.HandleVimVisual(r, readNext)
+	}
 	if r == CharEsc {
 		o.ExitVimInsertMode()
 		return 0
@@ -169,8 +1052,388 @@ func (o *opVim) HandleVim(r rune, readNext func() rune) rune {
 
 	switch o.vimMode {
 	case VIM_INSERT:
+		if o.recordInsert {
+			o.lastChange.insert = append(o.lastChange.insert, r)
+		}
 		return r
-	case VIM_VISUAL:
+	case VIM_REPLACE:
+		switch r {
+		case CharInterrupt:
+			o.ExitVimMode()
+			return r
+		case CharBackspace, CharCtrlH:
+		default:
+			if !IsPrintable(r) {
+				return r
+			}
+		}
+		if o.recordInsert {
+			o.lastChange.insert = append(o.lastChange.insert, r)
+		}
+		o.handleVimReplace(r)
+		return 0
 	}
 	return r
 }
+
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+const (
+	vimClassSpace = iota
+	vimClassPunct
+	vimClassWord
+)
+
+// the class of rune for word motions, WORD only splits by spaces
+func vimCharClass(r rune, bigWord bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return vimClassSpace
+	case bigWord:
+		return vimClassWord
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return vimClassWord
+	}
+	return vimClassPunct
+}
+
+// the start of next word, like `w`
+func vimNextWordStart(buf []rune, idx int, bigWord bool) int {
+	if idx >= len(buf) {
+		return len(buf)
+	}
+	class := vimCharClass(buf[idx], bigWord)
+	i := idx
+	if class != vimClassSpace {
+		for i < len(buf) && vimCharClass(buf[i], bigWord) == class {
+			i++
+		}
+	}
+	for i < len(buf) && vimCharClass(buf[i], bigWord) == vimClassSpace {
+		i++
+	}
+	return i
+}
+
+// the start of current or previous word, like `b`
+func vimPrevWordStart(buf []rune, idx int, bigWord bool) int {
+	i := idx - 1
+	for i > 0 && vimCharClass(buf[i], bigWord) == vimClassSpace {
+		i--
+	}
+	if i <= 0 {
+		return 0
+	}
+	class := vimCharClass(buf[i], bigWord)
+	for i > 0 && vimCharClass(buf[i-1], bigWord) == class {
+		i--
+	}
+	return i
+}
+
+// the end of current or next word, like `e`
+func vimWordEnd(buf []rune, idx int, bigWord bool) int {
+	i := idx + 1
+	for i < len(buf) && vimCharClass(buf[i], bigWord) == vimClassSpace {
+		i++
+	}
+	if i >= len(buf) {
+		if len(buf) == 0 {
+			return 0
+		}
+		return len(buf) - 1
+	}
+	class := vimCharClass(buf[i], bigWord)
+	for i+1 < len(buf) && vimCharClass(buf[i+1], bigWord) == class {
+		i++
+	}
+	return i
+}
+
+// find the rune ch like `f`, `F`, `t` and `T`, return -1 if not found
+func vimFindChar(buf []rune, idx int, ch rune, till, reverse bool) int {
+	if reverse {
+		for i := idx - 1; i >= 0; i-- {
+			if buf[i] == ch {
+				if till {
+					i++
+				}
+				return i
+			}
+		}
+		return -1
+	}
+	for i := idx + 1; i < len(buf); i++ {
+		if buf[i] == ch {
+			if till {
+				i--
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// vimMotion returns the position where the motion moves the cursor to
+// after count times, ok is false if r isn't a motion or the motion fails.
+func vimMotion(r rune, buf []rune, idx, count int, readNext func() rune) (pos int, ok bool) {
+	if count < 1 {
+		count = 1
+	}
+	switch r {
+	case 'f', 'F', 't', 'T':
+		next := readNext()
+		if next == CharEsc {
+			return idx, false
+		}
+		till, reverse := r == 't' || r == 'T', r == 'F' || r == 'T'
+		pos = idx
+		for i := 0; i < count; i++ {
+			// skip the adjacent match of the previous `t`
+			from := pos
+			if till && i > 0 {
+				if reverse {
+					from--
+				} else {
+					from++
+				}
+			}
+			pos = vimFindChar(buf, from, next, till, reverse)
+			if pos < 0 {
+				return idx, false
+			}
+		}
+		return pos, true
+	case '0', '^', '$', '%':
+		return vimMotionOnce(r, buf, idx)
+	}
+
+	pos = idx
+	for i := 0; i < count; i++ {
+		next, ok := vimMotionOnce(r, buf, pos)
+		if !ok {
+			return pos, i > 0
+		}
+		if next == pos {
+			// the motion stops at the start or the end of the buffer
+			break
+		}
+		pos = next
+	}
+	return pos, true
+}
+
+// the motions which include the rune under the target in the operator range
+func vimMotionInclusive(r rune) bool {
+	switch r {
+	case 'e', 'E', 'f', 't', '$', '%':
+		return true
+	}
+	return false
+}
+
+func vimMotionOnce(r rune, buf []rune, idx int) (pos int, ok bool) {
+	switch r {
+	case 'h', CharBackward:
+		if idx == 0 {
+			return idx, false
+		}
+		return runes.PrevCluster(buf, idx), true
+	case 'l', ' ', CharForward:
+		if idx >= len(buf) {
+			return idx, false
+		}
+		return runes.NextCluster(buf, idx), true
+	case '0':
+		return 0, true
+	case '^':
+		pos = 0
+		for pos < len(buf)-1 && unicode.IsSpace(buf[pos]) {
+			pos++
+		}
+		return pos, true
+	case '$':
+		return runes.PrevCluster(buf, len(buf)), true
+	case 'w', 'W':
+		return vimNextWordStart(buf, idx, r == 'W'), true
+	case 'b', 'B':
+		return vimPrevWordStart(buf, idx, r == 'B'), true
+	case 'e', 'E':
+		return vimWordEnd(buf, idx, r == 'E'), true
+	case '%':
+		return vimMatchPair(buf, idx)
+	}
+	return idx, false
+}
+
+// vimMatchPair finds the first bracket at or after idx in the line,
+// and returns the position of the bracket matching it.
+func vimMatchPair(buf []rune, idx int) (pos int, ok bool) {
+	const pairs = "()[]{}"
+	_, lineEnd := vimLineRange(buf, idx)
+	for ; idx < lineEnd; idx++ {
+		p := strings.IndexRune(pairs, buf[idx])
+		if p < 0 {
+			continue
+		}
+		open, close := rune(pairs[p&^1]), rune(pairs[p|1])
+		step := 1
+		if p&1 == 1 {
+			step = -1
+		}
+		depth := 0
+		for i := idx; i >= 0 && i < len(buf); i += step {
+			switch buf[i] {
+			case open:
+				depth += step
+			case close:
+				depth -= step
+			}
+			if depth == 0 {
+				return i, true
+			}
+		}
+		return idx, false
+	}
+	return idx, false
+}
+
+// vimTextObject returns the range [start, end) of the text object, like
+// `iw`, `a"` and `i(`, obj is the rune after `i` or `a`.
+func vimTextObject(buf []rune, idx int, around bool, obj rune) (start, end int, ok bool) {
+	if len(buf) == 0 {
+		return 0, 0, false
+	}
+	if idx >= len(buf) {
+		idx = len(buf) - 1
+	}
+	switch obj {
+	case 'w', 'W':
+		start, end = vimWordObject(buf, idx, around, obj == 'W')
+		return start, end, true
+	case '"', '\'', '`':
+		return vimQuoteObject(buf, idx, around, obj)
+	case '(', ')', 'b':
+		return vimPairObject(buf, idx, around, '(', ')')
+	case '[', ']':
+		return vimPairObject(buf, idx, around, '[', ']')
+	case '{', '}', 'B':
+		return vimPairObject(buf, idx, around, '{', '}')
+	case '<', '>':
+		return vimPairObject(buf, idx, around, '<', '>')
+	}
+	return 0, 0, false
+}
+
+func vimWordObject(buf []rune, idx int, around, bigWord bool) (start, end int) {
+	class := vimCharClass(buf[idx], bigWord)
+	start, end = idx, idx+1
+	for start > 0 && vimCharClass(buf[start-1], bigWord) == class {
+		start--
+	}
+	for end < len(buf) && vimCharClass(buf[end], bigWord) == class {
+		end++
+	}
+	if !around {
+		return start, end
+	}
+	if class == vimClassSpace {
+		// the spaces and the following word
+		if end < len(buf) {
+			_, end = vimWordObject(buf, end, false, bigWord)
+		}
+		return start, end
+	}
+	return vimAroundSpaces(buf, start, end)
+}
+
+// include the trailing spaces, or the leading spaces if there isn't any
+func vimAroundSpaces(buf []rune, start, end int) (int, int) {
+	if end < len(buf) && unicode.IsSpace(buf[end]) {
+		for end < len(buf) && unicode.IsSpace(buf[end]) {
+			end++
+		}
+		return start, end
+	}
+	for start > 0 && unicode.IsSpace(buf[start-1]) {
+		start--
+	}
+	return start, end
+}
+
+func vimQuoteObject(buf []rune, idx int, around bool, quote rune) (start, end int, ok bool) {
+	lineStart, lineEnd := vimLineRange(buf, idx)
+	var quotes []int
+	for i := lineStart; i < lineEnd; i++ {
+		if buf[i] == quote && (i == lineStart || buf[i-1] != '\\') {
+			quotes = append(quotes, i)
+		}
+	}
+	// the pair contains the cursor, or the first pair after it
+	for i := 0; i+1 < len(quotes); i += 2 {
+		if quotes[i+1] < idx {
+			continue
+		}
+		start, end = quotes[i], quotes[i+1]+1
+		if !around {
+			return start + 1, end - 1, true
+		}
+		start, end = vimAroundSpaces(buf, start, end)
+		return start, end, true
+	}
+	return 0, 0, false
+}
+
+func vimPairObject(buf []rune, idx int, around bool, open, close rune) (start, end int, ok bool) {
+	start, depth := -1, 0
+	for i := idx; i >= 0; i-- {
+		if buf[i] == close && i != idx {
+			depth++
+		} else if buf[i] == open {
+			if depth == 0 {
+				start = i
+				break
+			}
+			depth--
+		}
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+	end, depth = -1, 0
+	for i := start + 1; i < len(buf); i++ {
+		if buf[i] == open {
+			depth++
+		} else if buf[i] == close {
+			if depth == 0 {
+				end = i
+				break
+			}
+			depth--
+		}
+	}
+	if end < 0 {
+		return 0, 0, false
+	}
+	if around {
+		return start, end + 1, true
+	}
+	return start + 1, end, true
+}
+
+// the range of the line contains idx, lines are separated by '\n'
+func vimLineRange(buf []rune, idx int) (start, end int) {
+	start, end = idx, idx
+	for start > 0 && buf[start-1] != '\n' {
+		start--
+	}
+	for end < len(buf) && buf[end] != '\n' {
+		end++
+	}
+	return start, end
+}
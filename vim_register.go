@@ -0,0 +1,115 @@
+package readline
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+// vimRegisters holds the text yanked or deleted in vim mode:
+//
+//	`""`        the unnamed register, used if no register is specified
+//	`"0`        the last yanked text
+//	`"1` - `"9` the last deleted lines, shifted on each delete
+//	`"-`        the last deleted text within a line
+//	`"a` - `"z` the named registers, `"A` - `"Z` append to them
+//	`"_`        the black hole register, nothing is saved
+type vimRegisters struct {
+	unnamed  []rune
+	small    []rune
+	numbered [10][]rune
+	named    map[rune][]rune
+}
+
+func newVimRegisters() *vimRegisters {
+	return &vimRegisters{
+		named: make(map[rune][]rune),
+	}
+}
+
+func isVimRegister(r rune) bool {
+	switch {
+	case r == '"', r == '-', r == '_':
+	case r >= '0' && r <= '9':
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+	default:
+		return false
+	}
+	return true
+}
+
+// save the text into the named register, return false if reg isn't one
+func (v *vimRegisters) setNamed(reg rune, text []rune) bool {
+	switch {
+	case reg >= 'a' && reg <= 'z':
+		v.named[reg] = text
+	case reg >= 'A' && reg <= 'Z':
+		reg = unicode.ToLower(reg)
+		v.named[reg] = append(runes.Copy(v.named[reg]), text...)
+		text = v.named[reg]
+	default:
+		return false
+	}
+	v.unnamed = text
+	return true
+}
+
+// Yank saves the yanked text, reg is 0 if no register is specified.
+// It returns false if the unnamed register isn't changed.
+func (v *vimRegisters) Yank(reg rune, text []rune) bool {
+	text = runes.Copy(text)
+	if reg == '_' {
+		return false
+	}
+	if v.setNamed(reg, text) {
+		return true
+	}
+	v.numbered[0] = text
+	v.unnamed = text
+	return true
+}
+
+// Delete saves the deleted text, the lines deleted are shifted into the
+// numbered registers. It returns false if the unnamed register isn't changed.
+func (v *vimRegisters) Delete(reg rune, text []rune, linewise bool) bool {
+	text = runes.Copy(text)
+	if reg == '_' {
+		return false
+	}
+	if v.setNamed(reg, text) {
+		return true
+	}
+	if linewise {
+		copy(v.numbered[2:], v.numbered[1:9])
+		v.numbered[1] = text
+	} else {
+		v.small = text
+	}
+	v.unnamed = text
+	return true
+}
+
+// Get returns the text in the register, reg is 0 for the unnamed one.
+func (v *vimRegisters) Get(reg rune) []rune {
+	switch {
+	case reg == 0, reg == '"':
+		return v.unnamed
+	case reg == '-':
+		return v.small
+	case reg >= '0' && reg <= '9':
+		return v.numbered[reg-'0']
+	case reg >= 'a' && reg <= 'z', reg >= 'A' && reg <= 'Z':
+		return v.named[unicode.ToLower(reg)]
+	}
+	return nil
+}
+
+// OSC52Clipboard returns a hook for Config.FuncVimClipboard, it copies the
+// text to the system clipboard by the OSC 52 escape sequence, which works
+// even through ssh on most terminals.
+func OSC52Clipboard(w io.Writer) func(text []rune) {
+	return func(text []rune) {
+		fmt.Fprintf(w, "\033]52;c;%s\007", base64.StdEncoding.EncodeToString([]byte(string(text))))
+	}
+}
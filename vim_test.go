@@ -0,0 +1,378 @@
+package readline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/test"
+)
+
+func TestVimMotion(t *testing.T) {
+	defer test.New(t)
+
+	line := []rune("foo.bar  baz-qux ")
+	ret := []struct {
+		Key  string
+		Idx  int
+		Pos  int
+		Fail bool
+	}{
+		{"w", 0, 3, false},
+		{"W", 0, 9, false},
+		{"w", 4, 9, false},
+		{"b", 9, 4, false},
+		{"B", 9, 0, false},
+		{"e", 0, 2, false},
+		{"E", 0, 6, false},
+		{"e", 2, 3, false},
+		{"$", 3, 16, false},
+		{"0", 3, 0, false},
+		{"fz", 0, 11, false},
+		{"tz", 0, 10, false},
+		{"Fo", 9, 2, false},
+		{"To", 9, 3, false},
+		{"fy", 0, 0, true},
+		{"h", 0, 0, true},
+	}
+	for i, r := range ret {
+		keys := []rune(r.Key)
+		next := func() rune {
+			keys = keys[1:]
+			return keys[0]
+		}
+		pos, ok := vimMotion(keys[0], line, r.Idx, 1, next)
+		test.Equal(ok, !r.Fail, fmt.Errorf("%v", i))
+		if ok {
+			test.Equal(pos, r.Pos, fmt.Errorf("%v", i))
+		}
+	}
+}
+
+func TestVimOperator(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Pos  int
+		Keys string
+		Ret  string
+		Idx  int
+	}{
+		{"one two three four", 0, "3dw", "four", 0},
+		{"one two three", 4, "d$", "one ", 3},
+		{"one two three", 8, "c2bxy\033", "xythree", 1},
+		{"f(a, b)", 2, "dt)", "f()", 2},
+		{"f(a, b)", 2, "df,", "f( b)", 2},
+		{"a b c d", 0, "dw..", "d", 0},
+		{"one two", 0, "cwfoo\033w.", "foo foo", 6},
+		{"abcdef", 1, "2x.", "af", 1},
+		{"Hello World", 0, "gue", "hello World", 0},
+		{"hello", 0, ">>", "    hello", 4},
+		{"one two", 5, "dd", "", 0},
+		{"abc", 0, "3rx", "xxx", 2},
+		{"one two", 4, "D", "one ", 3},
+		{"one two", 4, "Cx\033", "one x", 4},
+		{"abcd", 3, "2X", "ad", 1},
+		{"abc", 0, "2~", "ABc", 2},
+		{"foo bar", 0, "g~w", "FOO bar", 0},
+		{"foo bar", 4, "gUU", "FOO BAR", 0},
+		{"foo bar", 0, "gUiw", "FOO bar", 0},
+		{"x = 9;", 0, "\x01", "x = 10;", 5},
+		{"x = 10;", 5, "3\x18", "x = 7;", 4},
+		{"x = 1;", 0, "5\x18", "x = -4;", 5},
+		{"x = 9223372036854775807", 0, "\x01", "x = 9223372036854775807", 0},
+		{"x = -9223372036854775808", 0, "\x18", "x = -9223372036854775808", 0},
+		{"", 0, ">>", "", 0},
+		{"abc👍🏽", 0, "D", "", 0},
+		{"abc👍🏽", 1, "d$", "a", 0},
+		{"ae\u0301b", 0, "dfe", "b", 0},
+		{"ab cd", 1, "cwX\033", "aX cd", 1},
+		{"a b c", 0, "cwX\033", "X b c", 0},
+		{"ab cd ef", 1, "2cwX\033", "aX ef", 1},
+		// the counts are capped instead of overflowing
+		{"abc", 0, "99999999999999999999x", "", 0},
+		{"one two", 0, "99999999999d99999999999w", "", 0},
+		{"abc", 0, "yiw9999999999999p", "abc", 0},
+		{"abc", 0, "yl1000000p", "a" + strings.Repeat("a", 1000000) + "bc", 1000000},
+		{"abc", 0, "r\r", "abc", 0},
+		{"abc", 0, "r\x7f", "abc", 0},
+		{"a,b,c,d", 0, "f,;d,", "a,c,d", 1},
+		{"a,b,c,d", 0, "t,;;", "a,b,c,d", 4},
+		{"f(a, (b))", 0, "d%", "", 0},
+		{"f(a, (b))", 8, "%", "f(a, (b))", 1},
+		{"abcd", 1, "Rxy\033", "axyd", 2},
+		{"ab", 1, "Rxyz\x7f\x7f\033", "ax", 1},
+		{"abcd", 0, "Rx\033l.", "xxcd", 1},
+		{"", 0, "ye", "", 0},
+		{"", 0, "yE", "", 0},
+		{"", 0, "de", "", 0},
+		{"", 0, "cex\033", "x", 0},
+		// the clusters are replaced and stepped over as a whole
+		{"e\u0301b", 0, "rx", "xb", 0},
+		{"a👍🏽b", 1, "rx", "axb", 1},
+		{"e\u0301👍🏽b", 0, "2rx", "xxb", 1},
+		{"e\u0301b", 0, "3rx", "e\u0301b", 0},
+		{"e\u0301b", 0, "~", "E\u0301b", 2},
+		{"👍🏽ab", 0, "2~", "👍🏽Ab", 3},
+		{"e\u0301b", 0, "Rxy\033", "xy", 1},
+		{"a👍🏽b", 1, "Rxy\x7f\x7f\033", "a👍🏽b", 0},
+	}
+	for i, r := range ret {
+		o := newTestVim(r.Line, r.Pos)
+		feedVim(o, r.Keys)
+		test.Equal(string(o.op.buf.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(o.op.buf.Pos(), r.Idx, fmt.Errorf("%v", i))
+	}
+}
+
+func TestVimVisual(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Pos  int
+		Keys string
+		Ret  string
+		Idx  int
+		Reg  string
+	}{
+		{"one two three", 4, "ved", "one  three", 4, "two"},
+		{"one two three", 4, "vbd", "wo three", 0, "one t"},
+		{"one two three", 4, "vecX\033", "one X three", 4, "two"},
+		{"one two three", 4, "vey", "one two three", 4, "two"},
+		{"one two three", 4, "vey$p", "one two threetwo", 15, "two"},
+		{"one two three", 4, "ve~", "one TWO three", 4, ""},
+		{"One Two", 0, "v$u", "one two", 0, ""},
+		{"One Two", 0, "vwU", "ONE Two", 0, ""},
+		{"one two", 4, "vlohd", "oneo", 3, " tw"},
+		// o moves the cursor to the other end
+		{"one two three", 4, "veohd", "one three", 3, " two"},
+		{"one\ntwo\nthree", 5, "Vd", "one\n\nthree", 4, "two"},
+		{"one\ntwo", 0, "VfoU", "ONE\nTWO", 0, ""},
+		{"one\ntwo", 5, "Vy", "one\ntwo", 4, "two"},
+		{"abc", 1, "vv", "abc", 1, ""},
+		{"abc", 1, "vVd", "", 0, "abc"},
+		// the selection starts and ends on the clusters
+		{"a\u0301b", 0, "vd", "b", 0, "a\u0301"},
+		{"xe\u0301", 1, "vd", "x", 0, "e\u0301"},
+		{"a你好b", 1, "vld", "ab", 1, "你好"},
+		{"a你好b", 2, "vhd", "ab", 1, "你好"},
+		{"x🇯🇵y", 1, "v~", "x🇯🇵y", 1, ""},
+		{"x🇯🇵y", 1, "vd", "xy", 1, "🇯🇵"},
+	}
+	for i, r := range ret {
+		o := newTestVim(r.Line, r.Pos)
+		feedVim(o, r.Keys)
+		test.Equal(string(o.op.buf.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(o.op.buf.Pos(), r.Idx, fmt.Errorf("%v", i))
+		test.Equal(o.vimMode, VIM_NORMAL, fmt.Errorf("%v", i))
+		if r.Reg != "" {
+			test.Equal(string(o.registers.Get(0)), r.Reg, fmt.Errorf("%v", i))
+		}
+	}
+}
+
+func TestVimTextObject(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Pos  int
+		Keys string
+		Ret  string
+	}{
+		{"foo bar baz", 5, "diw", "foo  baz"},
+		{"foo bar baz", 5, "daw", "foo baz"},
+		{"foo bar", 5, "daw", "foo"},
+		{"a.b c", 0, "diW", " c"},
+		{`say "hello world" now`, 7, `di"`, `say "" now`},
+		{`say "hello world" now`, 7, `da"`, `say now`},
+		{`say "hello" now`, 0, `ci"bye` + "\033", `say "bye" now`},
+		{"f(a, (b), c)", 3, "di(", "f()"},
+		{"f(a, (b), c)", 6, "da(", "f(a, , c)"},
+		{"f(a, (b), c)", 8, "dib", "f()"},
+		{"x[1] y{2}", 7, "ci{3\033", "x[1] y{3}"},
+		{"no pair", 2, "di(", "no pair"},
+		{"foo bar", 5, "viwd", "foo "},
+		{"f()", 1, "ci(x\033", "f(x)"},
+		{"f()", 2, "ci(x\033", "f(x)"},
+		{`say ""`, 4, `ci"x` + "\033", `say "x"`},
+		{`say ""`, 5, `di"`, `say ""`},
+	}
+	for i, r := range ret {
+		o := newTestVim(r.Line, r.Pos)
+		feedVim(o, r.Keys)
+		test.Equal(string(o.op.buf.Runes()), r.Ret, fmt.Errorf("%v", i))
+	}
+}
+
+func TestVimRegister(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Pos  int
+		Keys string
+		Ret  string
+		Idx  int
+	}{
+		{"one two", 0, "yw$p", "one twoone ", 10},
+		{"one two", 4, "yiw0P", "twoone two", 2},
+		{"one two", 0, `"ayiwwdiw"aP`, "oneone ", 5},
+		{"one two", 0, `"ayiww"Ayiw$"ap`, "one twoonetwo", 12},
+		{"abc", 0, `yiw"_ddp`, "abc", 2},
+		{"abc", 0, `dd"1p`, "abc", 2},
+		{"abc", 0, `x"-p`, "bac", 1},
+		{"ab", 0, "yl3p", "aaaab", 3},
+		{"ab", 0, `"!x`, "b", 0},
+	}
+	for i, r := range ret {
+		o := newTestVim(r.Line, r.Pos)
+		feedVim(o, r.Keys)
+		test.Equal(string(o.op.buf.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(o.op.buf.Pos(), r.Idx, fmt.Errorf("%v", i))
+	}
+}
+
+func TestVimRegisterShift(t *testing.T) {
+	defer test.New(t)
+
+	v := newVimRegisters()
+	v.Delete(0, []rune("a"), true)
+	v.Delete(0, []rune("b"), true)
+	v.Yank(0, []rune("c"))
+	test.Equal(string(v.Get('1')), "b")
+	test.Equal(string(v.Get('2')), "a")
+	test.Equal(string(v.Get('0')), "c")
+	test.Equal(string(v.Get(0)), "c")
+}
+
+func TestVimModeIndicator(t *testing.T) {
+	defer test.New(t)
+
+	o := newTestVim("abc", 3)
+	o.op.cfg.VimInsertIndicator = "[I] "
+	o.op.cfg.VimNormalIndicator = "[N] "
+	o.op.cfg.Painter = &defaultPainter{}
+	o.op.buf.SetPrompt("> ")
+
+	prompt := func() string {
+		out := string(o.op.buf.output())
+		return out[:strings.Index(out, "abc")]
+	}
+	o.beginVimLine()
+	test.Equal(prompt(), "[N] > ")
+	feedVim(o, "i")
+	test.Equal(prompt(), "[I] > ")
+	test.Equal(o.op.buf.PromptLen(), 6)
+	feedVim(o, "\033v")
+	test.Equal(prompt(), "[N] > ")
+	o.SetVimMode(false)
+	test.Equal(prompt(), "> ")
+}
+
+func TestVimUndo(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Line string
+		Keys string
+		Ret  string
+	}{
+		{"one two", "dwu", "one two"},
+		{"one two", "dwxu", "two"},
+		{"one two", "dwx2u", "one two"},
+		{"one two", "dwxuu\x12", "two"},
+		{"one two", "cwfoo\033u", "one two"},
+		{"one", "Afoo\033ubar\033u", "one"},
+		{"one", "u", "one"},
+	}
+	for i, r := range ret {
+		o := newTestVim(r.Line, 0)
+		o.beginVimLine()
+		feedVim(o, r.Keys)
+		test.Equal(string(o.op.buf.Runes()), r.Ret, fmt.Errorf("%v", i))
+	}
+}
+
+func TestVimSearch(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Keys string
+		Ret  string
+		Idx  int
+	}{
+		{"/git\r", "git commit", 0},
+		{"/git\rn", "git push", 0},
+		{"/git\rnN", "git commit", 0},
+		{"2/git\r", "git push", 0},
+		{"/push\r", "git push", 4},
+		{"/xyz\r", "", 0},
+		{"/git\r/\r", "git push", 0},
+		{"/git\x1b", "", 0},
+		{"/git\rn?\r", "git commit", 0},
+		{"k", "git commit", 10},
+		{"3k", "git push", 8},
+		{"5k", "git push", 8},
+		{"3k2j", "git commit", 10},
+		{"xk", "git commit", 10},
+	}
+	for i, r := range ret {
+		o := newTestVim("", 0)
+		o.op.cfg.HistoryLimit = 10
+		o.op.history = newOpHistory(o.op.cfg)
+		for _, line := range []string{"git push", "ls", "git commit"} {
+			o.op.history.New([]rune(line))
+		}
+		o.op.opSearch = newOpSearch(ioutil.Discard, o.op.buf, o.op.history, o.op.cfg, 80)
+		feedVim(o, r.Keys)
+		test.Equal(string(o.op.buf.Runes()), r.Ret, fmt.Errorf("%v", i))
+		test.Equal(o.op.buf.Pos(), r.Idx, fmt.Errorf("%v", i))
+	}
+}
+
+// the terminal waits after the keys ending the line which are read by the
+// vim commands
+func TestVimReadEnter(t *testing.T) {
+	defer test.New(t)
+
+	for i, keys := range []string{
+		"ab\x1b/a\r\r",
+		"ab\x1b/\x03\r",
+		"ab\x1b\"\r\r",
+		"ab\x1bd\r\r",
+		"ab\x1b2\r\r",
+		"ab\x1bci\r\r",
+	} {
+		line, err := readTestLine(&Config{VimMode: true}, keys)
+		test.Nil(err)
+		test.Equal(line, "ab", fmt.Errorf("%v", i))
+	}
+
+	// Ctrl-C after `r` interrupts the line
+	line, err := readTestLine(&Config{VimMode: true}, "abr")
+	test.Equal(err, ErrInterrupt)
+	test.Equal(line, "ab")
+}
+
+// the keys typed in insert mode are repeated by `.`, besides the printable
+func TestVimRepeatInsert(t *testing.T) {
+	defer test.New(t)
+
+	ret := []struct {
+		Keys string
+		Line string
+	}{
+		{"foo\033A bar baz\x17qux\033.\r", "foo bar qux bar qux"},
+		{"ab\033Axy\x7fz\033.\r", "abxzxz"},
+		{"ab\033Ic\x05d\033.\r", "ccabdd"},
+	}
+	for i, r := range ret {
+		line, err := readTestLine(&Config{VimMode: true}, r.Keys)
+		test.Nil(err)
+		test.Equal(line, r.Line, fmt.Errorf("%v", i))
+	}
+}